@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Lower bounds on the number of crafts a tree of node needs, used by the
+// best-first search after scaling them by the cheapest recipe. A heuristic
+// never overestimating keeps the result optimal.
+var heuristics = map[string]func(elementMap map[string]*ElementNode) func(node *ElementNode) float64{
+	// Plain uniform cost search
+	"zero": func(map[string]*ElementNode) func(*ElementNode) float64 {
+		return func(*ElementNode) float64 { return 0 }
+	},
+	// Each recipe lowers the tier, so a tree is at least as deep as the
+	// tier. Only a bound when the stored tiers are the crafting depth, as
+	// with -computed-tiers, and every base element is at tier 0, see
+	// tierBound.
+	"tier": func(map[string]*ElementNode) func(*ElementNode) float64 {
+		return func(node *ElementNode) float64 { return float64(node.Tier) }
+	},
+	// Height of the shallowest tree, computed from the recipes. A tree
+	// has at least one craft per level.
+	"height": func(elementMap map[string]*ElementNode) func(*ElementNode) float64 {
+		heights := make(map[*ElementNode]float64, len(elementMap))
+		var height func(node *ElementNode) float64
+		height = func(node *ElementNode) float64 {
+			if h, ok := heights[node]; ok {
+				return h
+			}
+			h := math.Inf(1)
+			if node.IsBase {
+				h = 0
+			}
+			for _, recipe := range node.Children {
+				if !recipe.usableFor(node.Tier) {
+					continue
+				}
+				deepest := 0.0
+				for _, ing := range recipe.Ingredients {
+					deepest = max(deepest, height(ing))
+				}
+				h = min(h, deepest+1)
+			}
+			heights[node] = h
+			return h
+		}
+		for _, node := range elementMap {
+			height(node)
+		}
+		return func(node *ElementNode) float64 { return heights[node] }
+	},
+}
+
+const defaultHeuristic = "height"
+
+// Owned elements are base elements above tier 0, a tree ending at one
+// needs fewer crafts than the tier of its root, so the tier is no bound
+func tierBound(elementMap map[string]*ElementNode) bool {
+	for _, node := range elementMap {
+		if node.IsBase && node.Tier > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func heuristicNames() []string {
+	var names []string
+	for name := range heuristics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type astarState struct {
+	// Estimated cost of the cheapest tree, exact once solved
+	cost     float64
+	best     *RecipeNode
+	expanded bool
+	solved   bool
+	parents  []*ElementNode
+}
+
+type astarStats struct {
+	// Heuristic used, zero when tier was asked for but is no bound
+	Heuristic string  `json:"heuristic"`
+	Weight    float64 `json:"weight"`
+	Expanded  int     `json:"expanded"`
+	// Cost of the first tree, the lowest possible when the heuristic is a
+	// lower bound and the weight is 1, at most weight times that otherwise
+	Cost float64 `json:"cost"`
+}
+
+// Best-first search over the AND/OR graph of elements and recipes (AO*)
+// for the tree of the lowest cost, see cost.go. It grows the cheapest
+// partial tree by expanding one of its open elements at a time and revises
+// the estimates of every element above it, until the cheapest tree only
+// ends in base elements. Estimates of open elements are weight times the
+// heuristic, a weight above 1 trades optimality for fewer expansions. Must
+// run on a fresh graph from buildGraph, stops without a tree once ctx is
+// done.
+func astar(ctx context.Context, root *ElementNode, elementMap map[string]*ElementNode, heuristic string, weight float64) (astarStats, bool) {
+	out := searchLog(ctx)
+	if heuristic == "" {
+		heuristic = defaultHeuristic
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	if heuristic == "tier" && !tierBound(elementMap) {
+		fmt.Fprintln(out, "[AStar] Base elements above tier 0, using the zero heuristic")
+		heuristic = "zero"
+	}
+	crafts := heuristics[heuristic](elementMap)
+	cheapest := math.Inf(1)
+	for _, node := range elementMap {
+		for _, recipe := range node.Children {
+			cheapest = min(cheapest, recipe.Cost)
+		}
+	}
+	h := func(node *ElementNode) float64 {
+		if c := crafts(node); c > 0 {
+			return c * cheapest
+		}
+		return 0
+	}
+	stats := astarStats{Heuristic: heuristic, Weight: weight}
+	states := make(map[*ElementNode]*astarState)
+	state := func(node *ElementNode) *astarState {
+		s, ok := states[node]
+		if !ok {
+			s = &astarState{cost: weight * h(node), solved: node.IsBase}
+			if node.IsBase {
+				s.cost = node.Cost
+			}
+			states[node] = s
+		}
+		return s
+	}
+
+	// Picks the cheapest recipe, true when the estimate or solved changed
+	revise := func(node *ElementNode) bool {
+		s := state(node)
+		cost, solved, best := math.Inf(1), false, (*RecipeNode)(nil)
+		for _, recipe := range node.Children {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			c, all := recipe.Cost, true
+			for _, ing := range recipe.Ingredients {
+				c += state(ing).cost
+				all = all && state(ing).solved
+			}
+			if c < cost {
+				cost, solved, best = c, all, recipe
+			}
+		}
+		changed := cost != s.cost || solved != s.solved
+		s.cost, s.solved, s.best = cost, solved, best
+		return changed
+	}
+
+	// First open element of the cheapest partial tree
+	var open func(node *ElementNode) *ElementNode
+	open = func(node *ElementNode) *ElementNode {
+		s := state(node)
+		if s.solved {
+			return nil
+		}
+		if !s.expanded {
+			return node
+		}
+		if s.best == nil {
+			return nil
+		}
+		for _, ing := range s.best.Ingredients {
+			if found := open(ing); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for !state(root).solved {
+		if ctx.Err() != nil {
+			return stats, false
+		}
+		if math.IsInf(state(root).cost, 1) {
+			fmt.Fprintf(out, "[AStar] %s cannot be crafted\n", root.Name)
+			return stats, false
+		}
+		node := open(root)
+		if node == nil {
+			return stats, false
+		}
+		s := state(node)
+		s.expanded = true
+		node.IsVisited = true
+		stats.Expanded++
+		for _, recipe := range node.Children {
+			// Recipes using node itself would make it its own parent
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			for _, ing := range recipe.Ingredients {
+				p := &state(ing).parents
+				*p = append(*p, node)
+			}
+		}
+		fmt.Fprintf(out, "[AStar] Expanding %s (tier %d), estimate %.1f\n", node.Name, node.Tier, s.cost)
+
+		queue := []*ElementNode{node}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			if revise(current) || current == node {
+				queue = append(queue, state(current).parents...)
+			}
+		}
+	}
+
+	// Leave only the chosen recipe of every expanded element, as the
+	// other algorithms leave the recipes they picked
+	for node, s := range states {
+		if !s.expanded {
+			continue
+		}
+		node.Children = nil
+		if s.best != nil {
+			node.Children = []*RecipeNode{s.best}
+		}
+	}
+	stats.Cost = state(root).cost
+	return stats, true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Every search option applies to all elements, the element of the
+// options is ignored
+type batchRequest struct {
+	SearchOptions
+	Elements    []string `json:"elements"`
+	Concurrency int      `json:"concurrency,omitempty"`
+}
+
+type batchResult struct {
+	Element string             `json:"element"`
+	Result  *ExportableElement `json:"result,omitempty"`
+	Error   string             `json:"error,omitempty"`
+	Cache   string             `json:"cache,omitempty"`
+}
+
+// Runs every element of the batch with at most limit searches in flight
+// and hands each result to emit as soon as it is done
+func runBatch(req batchRequest, limit int, search func(SearchOptions) (ExportableElement, string, error), emit func(int, batchResult)) {
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, name := range req.Elements {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			opts := req.SearchOptions
+			opts.Element = name
+			res := batchResult{Element: name}
+			tree, cacheStatus, err := search(opts)
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Result = &tree
+				res.Cache = cacheStatus
+			}
+			emit(i, res)
+		}(i, name)
+	}
+	wg.Wait()
+}
+
+// POST /batch answers with one JSON array, or with NDJSON lines in
+// completion order when ?stream=ndjson or Accept: application/x-ndjson
+func batchHandler(registry *datasetRegistry, cache *resultCache, maxConcurrency int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid batch body: " + err.Error()})
+			return
+		}
+		if req.Dataset == "" {
+			req.Dataset = r.URL.Query().Get("dataset")
+		}
+		// The whole batch runs against one snapshot
+		store, ok := registry.get(req.Dataset)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("dataset %q not found", req.Dataset)})
+			return
+		}
+		ds := store.load()
+		req.Dataset = ds.Name
+		w.Header().Set("X-Dataset", ds.Name)
+		w.Header().Set("X-Dataset-Version", ds.Version)
+		if len(req.Elements) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "elements must not be empty"})
+			return
+		}
+		// Validate the shared options once instead of failing every element
+		opts := req.SearchOptions
+		opts.Element = req.Elements[0]
+		if err := opts.validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		limit := maxConcurrency
+		if req.Concurrency > 0 && req.Concurrency < limit {
+			limit = req.Concurrency
+		}
+		limit = max(limit, 1)
+		fmt.Printf("Starting batch of %d elements with concurrency %d\n", len(req.Elements), limit)
+
+		search := func(opts SearchOptions) (ExportableElement, string, error) {
+			return cache.search(r.Context(), ds, opts, nil)
+		}
+
+		stream := r.URL.Query().Get("stream") == "ndjson" ||
+			strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+		if stream {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			flusher, _ := w.(http.Flusher)
+			var mu sync.Mutex
+			enc := json.NewEncoder(w)
+			runBatch(req, limit, search, func(_ int, res batchResult) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err := enc.Encode(res); err != nil {
+					fmt.Println("Error encoding batch result:", err)
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			})
+			return
+		}
+
+		results := make([]batchResult, len(req.Elements))
+		runBatch(req, limit, search, func(i int, res batchResult) {
+			results[i] = res
+		})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"dataset":        ds.Name,
+			"datasetVersion": ds.Version,
+			"results":        results,
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testBatch = `{"algorithm":"BFS","recipeAmount":2,"elements":["T3E1","Nope","T4E1"],"concurrency":2}`
+
+// Results come back in the order of the elements, an unknown element only
+// fails its own entry
+func TestBatch(t *testing.T) {
+	mux := testMux(t, serverConfig{BatchLimit: 4})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(testBatch)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Results []batchResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Results) != 3 {
+		t.Fatalf("%d results, want 3", len(body.Results))
+	}
+	for i, want := range []string{"T3E1", "Nope", "T4E1"} {
+		res := body.Results[i]
+		failed := want == "Nope"
+		if res.Element != want || (res.Error != "") != failed || (res.Result == nil) != failed {
+			t.Errorf("result %d: %+v, want %s", i, res, want)
+		}
+	}
+}
+
+// Streamed results are one JSON line per element, in completion order
+func TestBatchStream(t *testing.T) {
+	mux := testMux(t, serverConfig{BatchLimit: 4})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch?stream=ndjson", strings.NewReader(testBatch)))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type %q", ct)
+	}
+	seen := make(map[string]bool)
+	lines := bufio.NewScanner(rec.Body)
+	for lines.Scan() {
+		var res batchResult
+		if err := json.Unmarshal(lines.Bytes(), &res); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		seen[res.Element] = true
+	}
+	if len(seen) != 3 || !seen["T3E1"] || !seen["Nope"] || !seen["T4E1"] {
+		t.Errorf("streamed %v", seen)
+	}
+}
+
+// Invalid batches fail as a whole before any search runs
+func TestBatchErrors(t *testing.T) {
+	mux := testMux(t, serverConfig{BatchLimit: 4})
+	cases := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/batch", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/batch", "{", http.StatusBadRequest},
+		{http.MethodPost, "/batch", `{"algorithm":"BFS","recipeAmount":2,"elements":[]}`, http.StatusBadRequest},
+		{http.MethodPost, "/batch", `{"algorithm":"Nope","recipeAmount":2,"elements":["T3E1"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/batch", `{"algorithm":"BFS","recipeAmount":0,"elements":["T3E1"]}`, http.StatusBadRequest},
+		{http.MethodPost, "/batch?dataset=nope", testBatch, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(c.method, c.target, strings.NewReader(c.body)))
+		if rec.Code != c.want {
+			t.Errorf("%s %s %s: status %d, want %d", c.method, c.target, c.body, rec.Code, c.want)
+		}
+	}
+}
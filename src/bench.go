@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every algorithm and strategy combination the server accepts
+var benchCases = []SearchOptions{
+	{Algorithm: "DFS"},
+	{Algorithm: "BFS"},
+	{Algorithm: "IDDFS"},
+	{Algorithm: "AStar", Heuristic: "height"},
+	{Algorithm: "AStar", Heuristic: "height", Weight: 2},
+	{Algorithm: "Bidirectional", Left: "BFS", Right: "BFS"},
+	{Algorithm: "Bidirectional", Left: "BFS", Right: "DFS"},
+	{Algorithm: "Bidirectional", Left: "DFS", Right: "BFS"},
+	{Algorithm: "Bidirectional", Left: "DFS", Right: "DFS"},
+}
+
+func benchLabel(opts SearchOptions) string {
+	if opts.Algorithm == "Bidirectional" {
+		return opts.Algorithm + " " + opts.Left + "/" + opts.Right
+	}
+	if opts.Algorithm == "AStar" && opts.Weight > 1 {
+		return fmt.Sprintf("%s %s w=%g", opts.Algorithm, opts.Heuristic, opts.Weight)
+	}
+	if opts.Algorithm == "AStar" {
+		return opts.Algorithm + " " + opts.Heuristic
+	}
+	return opts.Algorithm
+}
+
+type benchResult struct {
+	Element      string  `json:"element"`
+	Tier         int     `json:"tier"`
+	Algorithm    string  `json:"algorithm"`
+	Left         string  `json:"left,omitempty"`
+	Right        string  `json:"right,omitempty"`
+	Heuristic    string  `json:"heuristic,omitempty"`
+	Weight       float64 `json:"weight,omitempty"`
+	RecipeAmount int     `json:"recipeAmount"`
+	Runs         int     `json:"runs"`
+	NsPerOp      int64   `json:"nsPerOp"`
+	WaitNsPerOp  int64   `json:"waitNsPerOp,omitempty"`
+	AllocsPerOp  int64   `json:"allocsPerOp"`
+	BytesPerOp   int64   `json:"bytesPerOp"`
+	Visited      int     `json:"visited"`
+	Nodes        int     `json:"nodes"`
+	Depth        int     `json:"depth"`
+	Recipes      int     `json:"recipes"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// Number of runs, or time spent in the algorithm, of one measurement
+type benchtime struct {
+	runs int
+	d    time.Duration
+}
+
+// Parses "5x" or a duration such as "200ms", as go test -benchtime
+func parseBenchtime(s string) (benchtime, error) {
+	if runs, ok := strings.CutSuffix(s, "x"); ok {
+		n, err := strconv.Atoi(runs)
+		if err != nil || n < 1 {
+			return benchtime{}, fmt.Errorf("invalid -benchtime %q", s)
+		}
+		return benchtime{runs: n}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return benchtime{}, fmt.Errorf("invalid -benchtime %q", s)
+	}
+	return benchtime{d: d}, nil
+}
+
+// Runs one search to record the shape of the result, then measures only
+// the algorithm on fresh graphs. Building the graph, counting and
+// exporting the trees is the same work for every algorithm, and the timed
+// runs log nowhere whatever ctx logs to. The time the left BFS of a
+// bidirectional search idles to end each tier is not counted, it is
+// reported apart.
+func benchSearch(ctx context.Context, elements []Element, opts SearchOptions, bt benchtime) benchResult {
+	res := benchResult{
+		Element:      opts.Element,
+		Algorithm:    opts.Algorithm,
+		Left:         opts.Left,
+		Right:        opts.Right,
+		Heuristic:    opts.Heuristic,
+		Weight:       opts.Weight,
+		RecipeAmount: opts.RecipeAmount,
+	}
+	tree, graph, err := searchGraph(ctx, elements, opts, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for _, node := range graph {
+		if node.IsVisited {
+			res.Visited++
+		}
+	}
+	res.Nodes = treeSize(tree)
+	res.Depth = treeDepth(tree)
+	res.Recipes = len(tree.Children)
+
+	quiet := withSearchLog(ctx, io.Discard)
+	var elapsed time.Duration
+	var allocs, bytes uint64
+	var before, after runtime.MemStats
+	var waited time.Duration
+	for res.Runs < bt.runs || elapsed < bt.d {
+		elementMap, allRecipes := buildGraph(elements)
+		var wait time.Duration
+		run := withDrainWait(quiet, &wait)
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		runAlgorithm(run, elementMap[opts.Element], elementMap, allRecipes, elements, opts, nil)
+		elapsed += time.Since(start) - wait
+		waited += wait
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+		res.Runs++
+	}
+	n := int64(res.Runs)
+	res.NsPerOp = elapsed.Nanoseconds() / n
+	res.WaitNsPerOp = waited.Nanoseconds() / n
+	res.AllocsPerOp = int64(allocs) / n
+	res.BytesPerOp = int64(bytes) / n
+	return res
+}
+
+func writeBenchCSV(w io.Writer, results []benchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"element", "tier", "algorithm", "left", "right", "heuristic", "weight", "recipe_amount", "runs",
+		"ns_per_op", "wait_ns_per_op", "allocs_per_op", "bytes_per_op", "visited", "nodes", "depth", "recipes", "error"})
+	for _, r := range results {
+		cw.Write([]string{
+			r.Element, strconv.Itoa(r.Tier), r.Algorithm, r.Left, r.Right, r.Heuristic,
+			strconv.FormatFloat(r.Weight, 'g', -1, 64), strconv.Itoa(r.RecipeAmount),
+			strconv.Itoa(r.Runs), strconv.FormatInt(r.NsPerOp, 10), strconv.FormatInt(r.WaitNsPerOp, 10), strconv.FormatInt(r.AllocsPerOp, 10),
+			strconv.FormatInt(r.BytesPerOp, 10), strconv.Itoa(r.Visited), strconv.Itoa(r.Nodes),
+			strconv.Itoa(r.Depth), strconv.Itoa(r.Recipes), r.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Averages per algorithm, printed after the run
+func writeBenchSummary(w io.Writer, results []benchResult) {
+	type total struct {
+		runs                        int
+		ns, allocs, visited, errors int64
+	}
+	totals := make(map[string]*total)
+	var labels []string
+	for _, r := range results {
+		label := benchLabel(SearchOptions{Algorithm: r.Algorithm, Left: r.Left, Right: r.Right, Heuristic: r.Heuristic, Weight: r.Weight})
+		t, ok := totals[label]
+		if !ok {
+			t = &total{}
+			totals[label] = t
+			labels = append(labels, label)
+		}
+		if r.Error != "" {
+			t.errors++
+			continue
+		}
+		t.runs++
+		t.ns += r.NsPerOp
+		t.allocs += r.AllocsPerOp
+		t.visited += int64(r.Visited)
+	}
+	sort.Strings(labels)
+	fmt.Fprintf(w, "Times exclude the %s the left BFS of Bidirectional waits for each tier to end, see wait_ns_per_op\n", leftDrainTimeout)
+	fmt.Fprintf(w, "%-24s %14s %14s %10s %8s\n", "algorithm", "avg time", "avg allocs", "visited", "errors")
+	for _, label := range labels {
+		t := totals[label]
+		if t.runs == 0 {
+			fmt.Fprintf(w, "%-24s %14s %14s %10s %8d\n", label, "-", "-", "-", t.errors)
+			continue
+		}
+		n := int64(t.runs)
+		fmt.Fprintf(w, "%-24s %14s %14d %10d %8d\n", label, time.Duration(t.ns/n), t.allocs/n, t.visited/n, t.errors)
+	}
+}
+
+// bench runs every algorithm over every element and reports time,
+// allocations, visited nodes and result size as CSV or JSON
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	only := fs.String("elements", "", "comma separated elements to run (default: every element that is not a base element)")
+	amounts := fs.String("n", "1", "comma separated recipe amounts to run")
+	algorithms := fs.String("algorithms", "", "comma separated cases, e.g. DFS,BFS,Bidirectional BFS/DFS (default: all)")
+	benchtimeFlag := fs.String("benchtime", "5x", "runs or algorithm time per measurement, e.g. 5x or 200ms")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("o", "", "write the report to this file instead of stdout")
+	verbose := fs.Bool("v", false, "show the algorithm log of the untimed runs on stderr")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+
+	bt, err := parseBenchtime(*benchtimeFlag)
+	if err != nil {
+		return err
+	}
+
+	var recipeAmounts []int
+	for _, s := range splitList(*amounts) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid recipe amount %q", s)
+		}
+		recipeAmounts = append(recipeAmounts, n)
+	}
+	cases := benchCases
+	if *algorithms != "" {
+		cases = nil
+		wanted := splitList(*algorithms)
+		for _, c := range benchCases {
+			if contains(wanted, benchLabel(c)) || contains(wanted, c.Algorithm) {
+				cases = append(cases, c)
+			}
+		}
+		if len(cases) == 0 {
+			return fmt.Errorf("no benchmark case matches %q", *algorithms)
+		}
+	}
+	var targets []Element
+	wanted := splitList(*only)
+	for _, el := range ds.Elements {
+		if (len(wanted) == 0 && !el.Base) || contains(wanted, el.Name) {
+			targets = append(targets, el)
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no elements to benchmark")
+	}
+
+	total := len(targets) * len(cases) * len(recipeAmounts)
+	fmt.Fprintf(os.Stderr, "Running %d benchmarks over %d elements\n", total, len(targets))
+	var results []benchResult
+	ctx := quietContext(*verbose)
+	for _, el := range targets {
+		for _, c := range cases {
+			for _, n := range recipeAmounts {
+				opts := c
+				opts.Element = el.Name
+				opts.RecipeAmount = n
+				res := benchSearch(ctx, ds.Elements, opts, bt)
+				res.Tier = el.Tier
+				results = append(results, res)
+				if len(results)%50 == 0 {
+					fmt.Fprintf(os.Stderr, "  %d/%d\n", len(results), total)
+				}
+			}
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "csv":
+		err = writeBenchCSV(w, results)
+	case "json":
+		err = writeJSONTo(w, results)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+	writeBenchSummary(os.Stderr, results)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Generated dataset with every defect the generator can add
+func testElements(tb testing.TB, opts generatorOptions) []Element {
+	tb.Helper()
+	elements, err := generateElements(opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return elements
+}
+
+var benchOptions = generatorOptions{
+	Elements:       200,
+	Base:           4,
+	Tiers:          10,
+	Recipes:        3,
+	MinIngredients: 2,
+	MaxIngredients: 3,
+	Cycles:         5,
+	Dangling:       5,
+	Seed:           1,
+}
+
+// Times only the algorithm, on a fresh graph every run, over the elements
+// of the highest tier. The time of Bidirectional includes the waits of its
+// left BFS to end each tier, reported apart as wait-ns/op.
+func BenchmarkSearch(b *testing.B) {
+	elements := testElements(b, benchOptions)
+	var targets []string
+	for _, el := range elements {
+		if el.Tier == benchOptions.Tiers {
+			targets = append(targets, el.Name)
+		}
+	}
+	for _, c := range benchCases {
+		b.Run(benchLabel(c), func(b *testing.B) {
+			b.ReportAllocs()
+			var wait time.Duration
+			ctx := withDrainWait(quietContext(false), &wait)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				opts := c
+				opts.Element = targets[i%len(targets)]
+				opts.RecipeAmount = 3
+				elementMap, allRecipes := buildGraph(elements)
+				b.StartTimer()
+				runAlgorithm(ctx, elementMap[opts.Element], elementMap, allRecipes, elements, opts, nil)
+			}
+			b.ReportMetric(float64(wait.Nanoseconds())/float64(b.N), "wait-ns/op")
+		})
+	}
+}
+
+// The left BFS of a bidirectional search reports the time it idles to end
+// a tier, which the bench command leaves out of its timings
+func TestLeftBFSDrainWait(t *testing.T) {
+	elements := testElements(t, generatorOptions{Elements: 20, Base: 3, Tiers: 3, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Seed: 1})
+	elementMap, allRecipes := buildGraph(elements)
+	var target *ElementNode
+	var basic []*ElementNode
+	for _, el := range elements {
+		switch {
+		case el.Base:
+			basic = append(basic, elementMap[el.Name])
+		case el.Tier == 1 && target == nil:
+			target = elementMap[el.Name]
+		}
+	}
+
+	// Never done, so the only tier ends once nothing new comes
+	var wait time.Duration
+	ctx := withDrainWait(quietContext(false), &wait)
+	start := time.Now()
+	Bidirect_Left_BFS(ctx, basic, target, elementMap, allRecipes, make(chan struct{}))
+	elapsed := time.Since(start)
+	if wait < leftDrainTimeout || wait > elapsed {
+		t.Errorf("waited %s of %s, want at least %s", wait, elapsed, leftDrainTimeout)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
@@ -57,44 +58,28 @@ func bfs_single(root *ElementNode, elements map[string]*ElementNode, recipes []R
 		// fmt.Println(current.Name)
 
 		for _, recipe := range recipes {
-			base1, ok1 := elements[recipe.Ingredient1.Name]
-			base2, ok2 := elements[recipe.Ingredient2.Name]
-
-			if !ok1 || !ok2 {
-				continue
-			}
-
 			if recipe.Result != current.Name {
 				continue
 			}
 
-			if base1.Tier >= current.Tier || base2.Tier >= current.Tier {
+			if !recipe.usableFor(current.Tier) {
 				continue
 			}
 
-			if ok1 && ok2 {
-				if len(current.Children) < 1 {
-
-					current.Children = append(current.Children, &RecipeNode{
-						Result:      current.Name,
-						Ingredient1: base1,
-						Ingredient2: base2,
-					})
-					//BFS
+			if len(current.Children) < 1 {
 
-					if !visited[base1.Name] {
-						// fmt.Println("Enque: ", base1.Name)
-						//Enqueue
-						q = append(q, base1)
-						visited[base1.Name] = true
-						base1.IsVisited = true
-					}
+				current.Children = append(current.Children, &RecipeNode{
+					Result:      current.Name,
+					Ingredients: recipe.Ingredients,
+				})
+				//BFS
 
-					if !visited[base2.Name] {
+				for _, base := range recipe.Ingredients {
+					if !visited[base.Name] {
 						//Enqueue
-						q = append(q, base2)
-						visited[base2.Name] = true
-						base2.IsVisited = true
+						q = append(q, base)
+						visited[base.Name] = true
+						base.IsVisited = true
 					}
 				}
 			}
@@ -105,10 +90,12 @@ func bfs_single(root *ElementNode, elements map[string]*ElementNode, recipes []R
 	}
 }
 
-func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeNode, limitRecipe int, ch chan int) {
+// Stops expanding elements once ctx is done, ch is still closed
+func bfs(ctx context.Context, root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeNode, limitRecipe int, ch chan int) {
+	out := searchLog(ctx)
 	// q := make(chan *ElementNode, 100)
 	visited := make(map[string]bool)
-	var mu sync.Mutex
+	mu := graphLock(ctx)
 	var ru sync.Mutex
 
 	mu.Lock()
@@ -130,7 +117,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 	// temp := []*RecipeNode{}
 	count := 0
 
-	for len(currentLevel) > 0 {
+	for len(currentLevel) > 0 && ctx.Err() == nil {
 		// wg.Add(1)
 		var wg sync.WaitGroup
 		var nextLevel []*ElementNode
@@ -149,28 +136,25 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 			// 	continue
 			// }
 
+			mu.Lock()
 			current.Children = []*RecipeNode{}
+			mu.Unlock()
 
 			wg.Add(1)
 			go func(current *ElementNode) {
 				defer wg.Done()
+				if current.IsBase {
+					return
+				}
 
 				for _, recipe := range recipes {
-
-					if recipe.Result != current.Name {
-						continue
+					if ctx.Err() != nil {
+						return
 					}
-					if recipe.Ingredient1 == nil || recipe.Ingredient2 == nil {
-						// fmt.Printf("Skipping recipe with nil ingredient: %+v\n", recipe)
-						continue
-					}
-					base1, ok1 := elements[recipe.Ingredient1.Name]
-					base2, ok2 := elements[recipe.Ingredient2.Name]
-					if !ok1 || !ok2 {
+					if recipe.Result != current.Name {
 						continue
 					}
-					if base1.Tier >= current.Tier || base2.Tier >= current.Tier {
-
+					if !recipe.usableFor(current.Tier) {
 						continue
 					}
 
@@ -193,7 +177,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 						// }
 						exist := false
 						for _, c := range current.Children {
-							if base1.Name == c.Ingredient1.Name && base2.Name == c.Ingredient2.Name {
+							if recipe.sameIngredients(c) {
 								exist = true
 								break
 							}
@@ -215,8 +199,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 
 						current.Children = append(current.Children, &RecipeNode{
 							Result:      current.Name,
-							Ingredient1: elements[base1.Name],
-							Ingredient2: elements[base2.Name],
+							Ingredients: recipe.Ingredients,
 						})
 						recipeMu.Lock()
 						recipeCount[current.Name] += 1
@@ -225,7 +208,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 					} else {
 						exist := false
 						for _, c := range current.Children {
-							if base1.Name == c.Ingredient1.Name && base2.Name == c.Ingredient2.Name {
+							if recipe.sameIngredients(c) {
 								exist = true
 								break
 							}
@@ -252,8 +235,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 						}
 						res := RecipeNode{
 							Result:      current.Name,
-							Ingredient1: elements[base1.Name],
-							Ingredient2: elements[base2.Name],
+							Ingredients: recipe.Ingredients,
 						}
 						recipeMu.Lock()
 
@@ -275,9 +257,9 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 						}
 						recipeMu.Unlock()
 						current.Children = append(current.Children, &res)
-						fmt.Printf("Appending recipe for %s, %s + %s\n", current.Name, base1.Name, base2.Name)
+						fmt.Fprintf(out, "Appending recipe for %s, %s\n", current.Name, &res)
 						if ch != nil {
-							fmt.Println("Level: ", currentLevel[0].Tier)
+							fmt.Fprintln(out, "Level: ", currentLevel[0].Tier)
 							ch <- currentLevel[0].Tier
 						}
 					}
@@ -285,25 +267,14 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 					mu.Unlock()
 					//BFS
 					mu.Lock()
-					if !base1.IsVisited {
-						fmt.Println("Enqueue: ", base1.Name)
-						//Enqueue
-						// wg.Add(1)
-						// if base1.Name == "Stone" {
-						// 	fmt.Println("STONE")
-						// }
-						nextLevel = append(nextLevel, base1)
-						visited[base1.Name] = true
-						base1.IsVisited = true
-					}
-
-					if !base2.IsVisited {
-						//Enqueue
-						// wg.Add(1)
-						nextLevel = append(nextLevel, base2)
-						fmt.Printf("Enqueue: %s\n", base2.Name)
-						visited[base2.Name] = true
-						base2.IsVisited = true
+					for _, base := range recipe.Ingredients {
+						if !base.IsVisited {
+							fmt.Fprintln(out, "Enqueue: ", base.Name)
+							//Enqueue
+							nextLevel = append(nextLevel, base)
+							visited[base.Name] = true
+							base.IsVisited = true
+						}
 					}
 					mu.Unlock()
 				}
@@ -312,7 +283,7 @@ func bfs(root *ElementNode, elements map[string]*ElementNode, recipes []*RecipeN
 		}
 		wg.Wait()
 
-		fmt.Println("Level: ", currentLevel[0].Tier)
+		fmt.Fprintln(out, "Level: ", currentLevel[0].Tier)
 		currentLevel = nextLevel
 
 		// }()
@@ -338,8 +309,9 @@ func (n ElementNode) display() {
 	fmt.Println("Name: ", n.Name)
 	for _, i := range r {
 		fmt.Println("===========================")
-		fmt.Println(i.Ingredient1.Name)
-		fmt.Println(i.Ingredient2.Name)
+		for _, ing := range i.Ingredients {
+			fmt.Println(ing.Name)
+		}
 	}
 	fmt.Println("END")
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -12,17 +13,19 @@ func Bidirect_Right_DFS(
 	elementMap map[string]*ElementNode,
 	depthChan chan int,
 	doneChan chan struct{},
+	search *dfsSearch,
 ) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		DFS_Multiple(root, wg, elementMap, depthChan, nil)
-		fmt.Println("[DFS Right] Done")
+		DFS_Multiple(root, wg, elementMap, depthChan, search)
+		fmt.Fprintln(searchLog(search.ctx), "[DFS Right] Done")
 		close(doneChan) // Notify BFS
 	}()
 }
 
 func Bidirect_Right_BFS(
+	ctx context.Context,
 	root *ElementNode,
 	limitRecipe int,
 	wg *sync.WaitGroup,
@@ -32,73 +35,80 @@ func Bidirect_Right_BFS(
 	doneChan chan struct{},
 ) {
 	go func() {
-		bfs(root, elementMap, allRecipes, limitRecipe, depthChan)
-		fmt.Println("[BFS Right] Done")
+		bfs(ctx, root, elementMap, allRecipes, limitRecipe, depthChan)
+		fmt.Fprintln(searchLog(ctx), "[BFS Right] Done")
 		close(doneChan) // Notify BFS
 	}()
 }
 
+// Time without new elements after which Bidirect_Left_BFS takes a tier as
+// complete
+const leftDrainTimeout = 500 * time.Millisecond
+
 func Bidirect_Left_BFS(
+	ctx context.Context,
 	basic []*ElementNode,
 	target *ElementNode,
 	allElement map[string]*ElementNode,
 	allRecipes []*RecipeNode,
 	doneChan <-chan struct{},
 ) {
-	fmt.Println("[BFS] Bidirect_Left_BFS started")
+	out := searchLog(ctx)
+	fmt.Fprintln(out, "[BFS] Bidirect_Left_BFS started")
 
 	discovered := make(map[string]*ElementNode)
 	tierElements := make(map[int][]*ElementNode)
+	// Shared with the right side, which writes the same nodes
+	mu := graphLock(ctx)
+	mu.Lock()
 	for _, el := range basic {
 		discovered[el.Name] = el
 		el.IsVisited = true
 		el.Left = true
-		fmt.Printf("[BFS] Added basic element: %s (tier %d)\n", el.Name, el.Tier)
+		fmt.Fprintf(out, "[BFS] Added basic element: %s (tier %d)\n", el.Name, el.Tier)
 		tierElements[el.Tier] = append(tierElements[el.Tier], el)
 	}
+	mu.Unlock()
 
 	ingredient := make(chan *ElementNode, 100)
 	var wg sync.WaitGroup
-	var mu sync.Mutex
 
 	// Worker
 	worker := func(id int, recipes []*RecipeNode) {
 		defer wg.Done()
-		fmt.Printf("[Worker %d] Started with %d recipes\n", id, len(recipes))
+		fmt.Fprintf(out, "[Worker %d] Started with %d recipes\n", id, len(recipes))
 		for _, recipe := range recipes {
 			select {
 			case <-doneChan:
-				fmt.Printf("[Worker %d] Received doneChan, exiting early\n", id)
+				fmt.Fprintf(out, "[Worker %d] Received doneChan, exiting early\n", id)
 				return
 			default:
 			}
 			mu.Lock()
-			in1 := recipe.Ingredient1
-			in2 := recipe.Ingredient2
 			result := allElement[recipe.Result]
 
 			if result.IsVisited {
-				fmt.Printf("[Worker %d] Skipped %s (already visited)\n", id, result.Name)
+				fmt.Fprintf(out, "[Worker %d] Skipped %s (already visited)\n", id, result.Name)
 				mu.Unlock()
 				continue
 			}
-			if !in1.IsVisited || !in2.IsVisited {
+			if !recipe.discovered() {
 				// fmt.Printf("[Worker %d] Skipped %s (missing ingredients)\n", id, result.Name)
 				mu.Unlock()
 				continue
 			}
 			if result.Tier >= target.Tier {
-				fmt.Printf("[Worker %d] Skipped %s (tier too high)\n", id, result.Name)
+				fmt.Fprintf(out, "[Worker %d] Skipped %s (tier too high)\n", id, result.Name)
 				mu.Unlock()
 				continue
 			}
-			if result.Tier <= in1.Tier || result.Tier <= in2.Tier {
-				fmt.Printf("[Worker %d] Skipped %s (tier not increasing)\n", id, result.Name)
+			if !recipe.usableFor(result.Tier) {
+				fmt.Fprintf(out, "[Worker %d] Skipped %s (tier not increasing)\n", id, result.Name)
 				mu.Unlock()
 				continue
 			}
 
-			fmt.Printf("[Worker %d] Checking recipe: %s (%d) + %s (%d) -> %s\n", id, in1.Name, in1.Tier, in2.Name, in2.Tier, result.Name)
+			fmt.Fprintf(out, "[Worker %d] Checking recipe: %s -> %s\n", id, recipe, result.Name)
 
 			result.IsVisited = true
 			result.Left = true
@@ -106,18 +116,18 @@ func Bidirect_Left_BFS(
 			result.Children = append(result.Children, recipe)
 			discovered[result.Name] = result
 			tierElements[result.Tier] = append(tierElements[result.Tier], result)
-			fmt.Printf("[Worker %d] Discovered new element: %s (tier %d)\n", id, result.Name, result.Tier)
+			fmt.Fprintf(out, "[Worker %d] Discovered new element: %s (tier %d)\n", id, result.Name, result.Tier)
 			mu.Unlock()
 			ingredient <- result
 		}
-		fmt.Printf("[Worker %d] Finished\n", id)
+		fmt.Fprintf(out, "[Worker %d] Finished\n", id)
 	}
 
 	for currentTier := range target.Tier {
-		fmt.Printf("[BFS] Processing tier %d -> %d\n", currentTier, currentTier+1)
+		fmt.Fprintf(out, "[BFS] Processing tier %d -> %d\n", currentTier, currentTier+1)
 		select {
 		case <-doneChan:
-			fmt.Println("[BFS] Cancelled by DFS (doneChan closed)")
+			fmt.Fprintln(out, "[BFS] Cancelled by DFS (doneChan closed)")
 			return
 		default:
 		}
@@ -131,7 +141,7 @@ func Bidirect_Left_BFS(
 				candidates = append(candidates, recipe)
 			}
 		}
-		fmt.Printf("[BFS] Tier %d: %d recipe candidates found\n", nextTier, len(candidates))
+		fmt.Fprintf(out, "[BFS] Tier %d: %d recipe candidates found\n", nextTier, len(candidates))
 
 		// Start workers
 		numWorkers := 4
@@ -152,75 +162,83 @@ func Bidirect_Left_BFS(
 		drained := false
 		count := 0
 		for !drained {
+			waitStart := time.Now()
 			select {
 			case <-doneChan:
-				fmt.Println("[BFS] Received doneChan signal during draining. Exiting early.")
+				fmt.Fprintln(out, "[BFS] Received doneChan signal during draining. Exiting early.")
 				return
 
 			case newEl := <-ingredient:
-				fmt.Printf("[BFS] -> New element added: %s (tier %d)\n", newEl.Name, newEl.Tier)
+				fmt.Fprintf(out, "[BFS] -> New element added: %s (tier %d)\n", newEl.Name, newEl.Tier)
 				count++
 				if newEl.Tier == target.Tier {
-					fmt.Printf("[BFS] Target tier %d reached with element %s\n", target.Tier, newEl.Name)
+					fmt.Fprintf(out, "[BFS] Target tier %d reached with element %s\n", target.Tier, newEl.Name)
 					return
 				}
 
-			case <-time.After(500 * time.Millisecond):
+			case <-time.After(leftDrainTimeout):
+				addDrainWait(ctx, time.Since(waitStart))
 				drained = true
 			}
 		}
-		fmt.Printf("[BFS] Tier %d complete, %d new elements discovered\n", currentTier, count)
+		fmt.Fprintf(out, "[BFS] Tier %d complete, %d new elements discovered\n", currentTier, count)
 	}
 
-	fmt.Println("[BFS Left] Finished")
+	fmt.Fprintln(out, "[BFS Left] Finished")
 }
 
 func Bidirect_Left_DFS(
+	ctx context.Context,
 	basic []*ElementNode,
 	target *ElementNode,
 	allElement map[string]*ElementNode,
 	allRecipes []*RecipeNode,
 	doneChan <-chan struct{},
 ) {
+	out := searchLog(ctx)
 	stack := make([]*ElementNode, 0)
-	var mu sync.Mutex
+	// Shared with the right side, which writes the same nodes
+	mu := graphLock(ctx)
 
 	// basic elements
+	mu.Lock()
 	for _, el := range basic {
 		stack = append(stack, el)
 		el.IsVisited = true
 		el.Left = true
 	}
+	mu.Unlock()
 
 	// DFS Loop
 	for len(stack) > 0 {
 		select {
 		case <-doneChan:
-			fmt.Println("[DFS] Received doneChan signal, exiting early.")
+			fmt.Fprintln(out, "[DFS] Received doneChan signal, exiting early.")
 			return
 		default:
 			currentElement := stack[len(stack)-1]
 			stack = stack[:len(stack)-1] // Pop
 
-			fmt.Printf("[DFS] Processing element: %s (tier %d)\n", currentElement.Name, currentElement.Tier)
+			fmt.Fprintf(out, "[DFS] Processing element: %s (tier %d)\n", currentElement.Name, currentElement.Tier)
 
 			if currentElement.Tier == target.Tier {
-				fmt.Printf("[DFS] Target tier %d reached with element %s\n", target.Tier, currentElement.Name)
+				fmt.Fprintf(out, "[DFS] Target tier %d reached with element %s\n", target.Tier, currentElement.Name)
 				return
 			}
 
 			for _, recipe := range allRecipes {
-				if currentElement.Name != recipe.Ingredient1.Name && currentElement.Name != recipe.Ingredient2.Name {
+				if !recipe.uses(currentElement) {
 					continue
 				}
 
 				newElement := allElement[recipe.Result]
-				if newElement == nil || newElement.IsVisited || !recipe.Ingredient1.IsVisited || !recipe.Ingredient2.IsVisited || newElement.Tier >= target.Tier {
+				mu.Lock()
+				if newElement == nil || newElement.IsVisited || !recipe.discovered() || newElement.Tier >= target.Tier || !recipe.usableFor(newElement.Tier) {
+					mu.Unlock()
 					continue
 				}
 
 				// push
-				mu.Lock()
 				newElement.IsVisited = true
 				newElement.Left = true
 				newElement.Children = make([]*RecipeNode, 0)
@@ -228,12 +246,12 @@ func Bidirect_Left_DFS(
 				mu.Unlock()
 
 				stack = append(stack, newElement)
-				fmt.Printf("[DFS] Discovered new element: %s (tier %d)\n", newElement.Name, newElement.Tier)
+				fmt.Fprintf(out, "[DFS] Discovered new element: %s (tier %d)\n", newElement.Name, newElement.Tier)
 			}
 		}
 	}
 
-	fmt.Println("[DFS Left] No more elements to process. Exiting DFS.")
+	fmt.Fprintln(out, "[DFS Left] No more elements to process. Exiting DFS.")
 }
 
 // func BuildExportableElements(tier0Elements []*ElementNode, maxTier int) map[*ElementNode]*ExportableElement {
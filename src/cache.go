@@ -0,0 +1,252 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+// Bumped when the shape of search results changes, so entries persisted by
+// an older build are not served
+const cacheFormat = "trees"
+
+func cacheKey(version string, opts SearchOptions) string {
+	strategies := ""
+	if opts.Algorithm == "Bidirectional" {
+		strategies = opts.Left + "/" + opts.Right
+	}
+	if opts.Algorithm == "AStar" {
+		strategies = opts.Heuristic + "/" + strconv.FormatFloat(opts.Weight, 'g', -1, 64)
+	}
+	if len(opts.Costs) > 0 || len(opts.Owned) > 0 {
+		var costs []string
+		for name, c := range opts.Costs {
+			costs = append(costs, name+":"+strconv.FormatFloat(c, 'g', -1, 64))
+		}
+		sort.Strings(costs)
+		owned := append([]string(nil), opts.Owned...)
+		sort.Strings(owned)
+		strategies += "|" + strings.Join(costs, ",") + "|" + strings.Join(owned, ",")
+	}
+	if opts.Diverse {
+		strategies += "|diverse"
+	}
+	return version + "|" + cacheFormat + "|" + opts.Algorithm + "|" + strategies + "|" +
+		strconv.Itoa(opts.RecipeAmount) + "|" + opts.Element
+}
+
+type cacheEntry struct {
+	Key   string            `json:"key"`
+	Value ExportableElement `json:"value"`
+}
+
+type cacheStats struct {
+	Size      int   `json:"size"`
+	Capacity  int   `json:"capacity"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Bypassed  int64 `json:"bypassed"`
+	Evictions int64 `json:"evictions"`
+}
+
+// LRU of finished search results, optionally persisted to a file
+type resultCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	stats    cacheStats
+	path     string
+	dirty    bool
+}
+
+func newResultCache(capacity int, path string) *resultCache {
+	c := &resultCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		path:     path,
+	}
+	if path != "" {
+		if err := c.load(); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Error loading cache file:", err)
+		}
+		go c.persistLoop(30 * time.Second)
+	}
+	return c
+}
+
+func (c *resultCache) get(key string) (ExportableElement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.stats.Hits++
+		return el.Value.(*cacheEntry).Value, true
+	}
+	c.stats.Misses++
+	return ExportableElement{}, false
+}
+
+func (c *resultCache) put(key string, value ExportableElement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, value)
+	c.dirty = true
+}
+
+// Caller holds c.mu
+func (c *resultCache) add(key string, value ExportableElement) {
+	if c.capacity <= 0 {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).Value = value
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{Key: key, Value: value})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).Key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *resultCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.dirty = true
+	fmt.Println("Result cache purged")
+}
+
+// Drops the results computed from one dataset version
+func (c *resultCache) purgeVersion(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, el := range c.items {
+		if strings.HasPrefix(key, version+"|") {
+			c.ll.Remove(el)
+			delete(c.items, key)
+			removed++
+		}
+	}
+	c.dirty = true
+	fmt.Printf("Result cache purged %d results of version %s\n", removed, version)
+}
+
+func (c *resultCache) snapshotStats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.ll.Len()
+	s.Capacity = c.capacity
+	return s
+}
+
+// Looks the search up in the cache before running it. A nil cache or
+// opts.NoCache skips the cache entirely.
+func (c *resultCache) search(ctx context.Context, ds *dataset, opts SearchOptions, progress func(int)) (ExportableElement, string, error) {
+	if c == nil || opts.NoCache {
+		if c != nil {
+			c.mu.Lock()
+			c.stats.Bypassed++
+			c.mu.Unlock()
+		}
+		res, err := runSearch(ctx, ds.Elements, opts, progress)
+		return res, cacheBypass, err
+	}
+	key := cacheKey(ds.Version, opts)
+	if res, ok := c.get(key); ok {
+		return res, cacheHit, nil
+	}
+	res, err := runSearch(ctx, ds.Elements, opts, progress)
+	if err != nil {
+		return res, cacheMiss, err
+	}
+	c.put(key, res)
+	return res, cacheMiss, nil
+}
+
+func (c *resultCache) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	var entries []cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Entries are stored most recent first
+	for i := len(entries) - 1; i >= 0; i-- {
+		c.add(entries[i].Key, entries[i].Value)
+	}
+	fmt.Printf("Loaded %d cached results from %s\n", len(entries), c.path)
+	return nil
+}
+
+func (c *resultCache) save() error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	entries := make([]cacheEntry, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		entries = append(entries, *el.Value.(*cacheEntry))
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *resultCache) persistLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := c.save(); err != nil {
+			fmt.Println("Error saving cache file:", err)
+		}
+	}
+}
+
+// GET /cache returns the metrics, DELETE /cache empties the cache and needs
+// the admin token
+func (c *resultCache) handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, c.snapshotStats())
+	case http.MethodDelete:
+		c.purge()
+		writeJSON(w, http.StatusOK, c.snapshotStats())
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or DELETE"})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Full caches drop the entry used least recently
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newResultCache(2, "")
+	c.put("a", ExportableElement{Name: "A"})
+	c.put("b", ExportableElement{Name: "B"})
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a missing before the cache is full")
+	}
+	c.put("c", ExportableElement{Name: "C"})
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b kept, it was used least recently")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s evicted", key)
+		}
+	}
+	if s := c.snapshotStats(); s.Size != 2 || s.Evictions != 1 {
+		t.Errorf("size %d with %d evictions, want 2 and 1", s.Size, s.Evictions)
+	}
+}
+
+// Purging a version keeps the results of every other version, including
+// versions it is a prefix of
+func TestCachePurgeVersion(t *testing.T) {
+	c := newResultCache(8, "")
+	opts := SearchOptions{Element: "Steam", Algorithm: "BFS", RecipeAmount: 1}
+	for _, version := range []string{"v1", "v10", "v2"} {
+		c.put(cacheKey(version, opts), ExportableElement{Name: version})
+	}
+	c.purgeVersion("v1")
+
+	if _, ok := c.get(cacheKey("v1", opts)); ok {
+		t.Error("result of v1 kept")
+	}
+	for _, version := range []string{"v10", "v2"} {
+		if res, ok := c.get(cacheKey(version, opts)); !ok || res.Name != version {
+			t.Errorf("result of %s lost", version)
+		}
+	}
+}
+
+// NoCache searches neither read nor fill the cache and are counted apart
+func TestCacheNoCacheBypass(t *testing.T) {
+	store, _ := testRegistry(t).get("test")
+	ds := store.load()
+	c := newResultCache(8, "")
+	opts := SearchOptions{Element: "T3E1", Algorithm: "BFS", RecipeAmount: 2, NoCache: true}
+	ctx := quietContext(false)
+
+	for i := 0; i < 2; i++ {
+		if _, status, err := c.search(ctx, ds, opts, nil); err != nil || status != cacheBypass {
+			t.Fatalf("status %s, error %v, want %s", status, err, cacheBypass)
+		}
+	}
+	if s := c.snapshotStats(); s.Bypassed != 2 || s.Size != 0 || s.Hits != 0 || s.Misses != 0 {
+		t.Errorf("stats %+v after two bypassed searches", s)
+	}
+
+	opts.NoCache = false
+	for _, want := range []string{cacheMiss, cacheHit} {
+		if _, status, err := c.search(ctx, ds, opts, nil); err != nil || status != want {
+			t.Errorf("status %s, error %v, want %s", status, err, want)
+		}
+	}
+	if s := c.snapshotStats(); s.Bypassed != 2 || s.Size != 1 || s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("stats %+v after a miss and a hit", s)
+	}
+}
+
+// Reading the metrics needs no token, emptying the cache does
+func TestCacheDeleteNeedsAdmin(t *testing.T) {
+	mux := testMux(t, serverConfig{AdminToken: "secret"})
+	cases := []struct {
+		method, token string
+		want          int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodDelete, "", http.StatusUnauthorized},
+		{http.MethodDelete, "wrong", http.StatusUnauthorized},
+		{http.MethodDelete, "secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/cache", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s /cache with token %q: status %d, want %d", c.method, c.token, rec.Code, c.want)
+		}
+	}
+}
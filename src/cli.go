@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Subcommands of the binary, the server runs when none is given
+var commands = map[string]func(args []string) error{
+	"import":        importCommand,
+	"mirror-images": mirrorImagesCommand,
+	"bfs":           searchCommand("BFS"),
+	"dfs":           searchCommand("DFS"),
+	"bidirectional": searchCommand("Bidirectional"),
+	"iddfs":         searchCommand("IDDFS"),
+	"astar":         searchCommand("AStar"),
+	"count":         countCommand,
+	"uses":          usesCommand,
+	"export":        exportCommand,
+	"repl":          replCommand,
+	"bench":         benchCommand,
+	"verify":        verifyCommand,
+	"generate":      generateCommand,
+	"sample":        sampleCommand,
+}
+
+// Reads a snapshot file, or scrapes the game when dataFile is empty
+func loadDataset(dataFile, game string, base []string) (*dataset, error) {
+	var jsonBytes []byte
+	var err error
+	if dataFile == "" {
+		scraper, ok := scrapers[game]
+		if !ok {
+			return nil, fmt.Errorf("unknown game %q", game)
+		}
+		jsonBytes, err = convertToJson(scraper())
+		dataFile = game
+	} else {
+		jsonBytes, err = os.ReadFile(dataFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDataset(dataFile, jsonBytes, base)
+}
+
+// mirror-images downloads every element icon into a local directory that
+// the server then serves under /api/images/
+func mirrorImagesCommand(args []string) error {
+	fs := flag.NewFlagSet("mirror-images", flag.ContinueOnError)
+	dataFile := fs.String("data", "", "dataset snapshot to read the icons from (default: scrape -game)")
+	game := fs.String("game", "la2", "game scraped when -data is not set, la2 or la1")
+	dir := fs.String("dir", "images", "directory the icons are stored in")
+	workers := fs.Int("concurrency", 8, "number of downloads run at once")
+	force := fs.Bool("force", false, "download icons that are already mirrored again")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ds, err := loadDataset(*dataFile, *game, nil)
+	if err != nil {
+		return err
+	}
+	store := &imageStore{dir: *dir}
+	stats, err := store.mirror(ds.Elements, *workers, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Mirrored %d icons to %s, %d already present, %d elements without icon, %d failed\n",
+		stats.Downloaded, *dir, stats.Skipped, stats.NoImage, len(stats.Failed))
+	if len(stats.Failed) > 0 {
+		return fmt.Errorf("could not mirror %s", strings.Join(stats.Failed, ", "))
+	}
+	return nil
+}
+
+// import validates a recipe pack and writes it as a dataset snapshot, or
+// uploads it to a running server with -server
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "pack format: json, yaml or csv (default from the file extension)")
+	autoTier := fs.Bool("auto-tier", false, "compute tiers from the recipes")
+	base := fs.String("base", "", "comma separated base elements, overrides the pack")
+	out := fs.String("o", "", "write the dataset snapshot to this file instead of stdout")
+	server := fs.String("server", "", "upload the pack to this server, e.g. http://localhost:8080")
+	name := fs.String("name", "", "dataset name used with -server (default: the pack name)")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "admin token used with -server")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: import [flags] pack.{json,yaml,csv}")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one pack file")
+	}
+	path := fs.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = packFormat(path)
+	}
+
+	jsonBytes, pack, err := importPack(data, *format, *autoTier, splitList(*base))
+	if errs, ok := err.(packErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, " -", e)
+		}
+		return fmt.Errorf("%s has %d problem(s)", path, len(errs))
+	}
+	if err != nil {
+		return err
+	}
+
+	if *server == "" {
+		if *out == "" {
+			_, err = os.Stdout.Write(jsonBytes)
+			return err
+		}
+		if err := os.WriteFile(*out, jsonBytes, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d elements to %s\n", len(pack.Elements), *out)
+		return nil
+	}
+
+	if *name == "" {
+		*name = pack.Name
+	}
+	if *name == "" {
+		return fmt.Errorf("-name is required when the pack has no name")
+	}
+	query := url.Values{"format": {*format}}
+	if *autoTier {
+		query.Set("autoTier", "true")
+	}
+	if *base != "" {
+		query.Set("base", *base)
+	}
+	target := strings.TrimRight(*server, "/") + "/datasets/" + url.PathEscape(*name) + "?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPut, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Println(strings.TrimSpace(string(body)))
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Costs of a tree: every craft costs its recipe, every leaf its element.
+// Without costs in the dataset or the request a craft costs 1 and a base
+// element 0, so the cost of a tree is its number of crafts.
+const defaultRecipeCost = 1
+
+// Cost of crafting with recipe i of el
+func (el Element) recipeCost(i int) float64 {
+	if i < len(el.RecipeCosts) {
+		return el.RecipeCosts[i]
+	}
+	if el.Cost != nil {
+		return *el.Cost
+	}
+	return defaultRecipeCost
+}
+
+// Cost of el used as a leaf
+func (el Element) leafCost() float64 {
+	if el.Cost != nil && el.Base {
+		return *el.Cost
+	}
+	return 0
+}
+
+func validCost(c float64) bool {
+	return c >= 0 && !math.IsInf(c, 0) && !math.IsNaN(c)
+}
+
+func validateCosts(el Element) error {
+	if el.Cost != nil && !validCost(*el.Cost) {
+		return fmt.Errorf("element %q has invalid cost %g", el.Name, *el.Cost)
+	}
+	if len(el.RecipeCosts) > 0 && len(el.RecipeCosts) != len(el.Recipes) {
+		return fmt.Errorf("element %q has %d recipe costs for %d recipes", el.Name, len(el.RecipeCosts), len(el.Recipes))
+	}
+	for i, c := range el.RecipeCosts {
+		if !validCost(c) {
+			return fmt.Errorf("recipe #%d of %q has invalid cost %g", i+1, el.Name, c)
+		}
+	}
+	return nil
+}
+
+func hasCosts(elements []Element) bool {
+	for _, el := range elements {
+		if el.Cost != nil || len(el.RecipeCosts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses "Fire:2,Steam:0.5", the name is everything before the last colon
+func parseCosts(s string) (map[string]float64, error) {
+	costs := make(map[string]float64)
+	for _, item := range splitList(s) {
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid cost %q, expected NAME:COST", item)
+		}
+		c, err := strconv.ParseFloat(strings.TrimSpace(item[i+1:]), 64)
+		if err != nil || !validCost(c) {
+			return nil, fmt.Errorf("invalid cost %q, expected a number of at least 0", item)
+		}
+		costs[strings.TrimSpace(item[:i])] = c
+	}
+	return costs, nil
+}
+
+// Copy of the elements with the costs and owned elements of a request.
+// Owned elements become base elements, leaves that cost nothing unless a
+// cost is given for them.
+func applyCostOptions(elements []Element, opts SearchOptions) ([]Element, error) {
+	if len(opts.Costs) == 0 && len(opts.Owned) == 0 {
+		return elements, nil
+	}
+	known := make(map[string]bool, len(elements))
+	out := make([]Element, len(elements))
+	for i, el := range elements {
+		known[el.Name] = true
+		if c, ok := opts.Costs[el.Name]; ok {
+			// The request replaces the recipe costs of the dataset too
+			el.Cost = &c
+			el.RecipeCosts = nil
+		}
+		if contains(opts.Owned, el.Name) {
+			el.Base = true
+			if _, ok := opts.Costs[el.Name]; !ok {
+				el.Cost = nil
+			}
+		}
+		out[i] = el
+	}
+	for name := range opts.Costs {
+		if !known[name] {
+			return nil, fmt.Errorf("cost given for unknown element %q", name)
+		}
+	}
+	for _, name := range opts.Owned {
+		if !known[name] {
+			return nil, fmt.Errorf("owned element %q is not in the dataset", name)
+		}
+	}
+	return out, nil
+}
+
+// One line of a cost breakdown, an element made or used count times
+type costItem struct {
+	Element string  `json:"element"`
+	Recipe  string  `json:"recipe,omitempty"`
+	Count   int     `json:"count"`
+	Cost    float64 `json:"cost"`
+	Total   float64 `json:"total"`
+}
+
+type treeCost struct {
+	Total     float64    `json:"total"`
+	Breakdown []costItem `json:"breakdown"`
+}
+
+// Cost of every tree of a result, and a Cost attribute on every element
+// with what it adds to its tree
+func annotateCosts(result *ExportableElement, elementMap map[string]*ElementNode) []treeCost {
+	var walk func(el *ExportableElement, items map[string]*costItem, top bool) float64
+	walk = func(el *ExportableElement, items map[string]*costItem, top bool) float64 {
+		node := elementMap[el.Name]
+		if node == nil {
+			return 0
+		}
+		key, cost, recipeName := el.Name, node.Cost, ""
+		if len(el.Children) > 0 {
+			names := make([]string, len(el.Children[0].Children))
+			for i, ing := range el.Children[0].Children {
+				names[i] = ing.Name
+			}
+			recipeName = strings.Join(names, " + ")
+			key += "=" + recipeName
+			cost = defaultRecipeCost
+			for _, recipe := range node.Children {
+				if recipe.String() == recipeName {
+					cost = recipe.Cost
+					break
+				}
+			}
+		}
+		// The result node is shared by every tree, it only gets the totals
+		if !top {
+			el.Attributes["Cost"] = strconv.FormatFloat(cost, 'g', -1, 64)
+		}
+		item, ok := items[key]
+		if !ok {
+			item = &costItem{Element: el.Name, Recipe: recipeName, Cost: cost}
+			items[key] = item
+		}
+		item.Count++
+		item.Total += cost
+		total := cost
+		for _, recipe := range el.Children {
+			for i := range recipe.Children {
+				total += walk(&recipe.Children[i], items, false)
+			}
+		}
+		return total
+	}
+
+	var costs []treeCost
+	for i := range result.Children {
+		items := make(map[string]*costItem)
+		// The root of each tree is the shared result node with one recipe
+		root := ExportableElement{Name: result.Name, Attributes: result.Attributes, Children: result.Children[i : i+1]}
+		tc := treeCost{Total: walk(&root, items, true)}
+		for _, item := range items {
+			tc.Breakdown = append(tc.Breakdown, *item)
+		}
+		sort.Slice(tc.Breakdown, func(a, b int) bool {
+			if tc.Breakdown[a].Total != tc.Breakdown[b].Total {
+				return tc.Breakdown[a].Total > tc.Breakdown[b].Total
+			}
+			return tc.Breakdown[a].Element < tc.Breakdown[b].Element
+		})
+		costs = append(costs, tc)
+	}
+	if len(result.Children) == 0 {
+		if node := elementMap[result.Name]; node != nil && node.IsBase {
+			costs = append(costs, treeCost{Total: node.Cost, Breakdown: []costItem{{Element: node.Name, Count: 1, Cost: node.Cost, Total: node.Cost}}})
+			result.Attributes["Cost"] = strconv.FormatFloat(node.Cost, 'g', -1, 64)
+		}
+	}
+	return costs
+}
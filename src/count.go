@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/big"
+)
+
+// Counts the distinct complete crafting trees of every element. A base
+// element has exactly one tree, any other element the sum over its usable
+// recipes of the product of its ingredients' counts. Recipes must lower the
+// tier, so the graph is acyclic and every count is finite.
+type treeCounter struct {
+	elements map[string]*ElementNode
+	memo     map[*ElementNode]*big.Int
+}
+
+func newTreeCounter(elements map[string]*ElementNode) *treeCounter {
+	return &treeCounter{
+		elements: elements,
+		memo:     make(map[*ElementNode]*big.Int),
+	}
+}
+
+func (c *treeCounter) count(node *ElementNode) *big.Int {
+	if n, ok := c.memo[node]; ok {
+		return n
+	}
+	total := new(big.Int)
+	if node.IsBase {
+		total.SetInt64(1)
+	} else {
+		for _, recipe := range node.Children {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			product := big.NewInt(1)
+			for _, ing := range recipe.Ingredients {
+				product.Mul(product, c.count(ing))
+			}
+			total.Add(total, product)
+		}
+	}
+	c.memo[node] = total
+	return total
+}
+
+// Number of trees of the named element, nil when it does not exist
+func (c *treeCounter) countName(name string) *big.Int {
+	node, ok := c.elements[name]
+	if !ok {
+		return nil
+	}
+	return c.count(node)
+}
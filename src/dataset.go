@@ -0,0 +1,416 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// An immutable snapshot of the recipe data. Searches hold on to the
+// snapshot they started with, so a reload never changes data under them.
+type dataset struct {
+	Name     string
+	Version  string
+	Elements []Element
+	// Names of the starting elements
+	Base     []string
+	LoadedAt time.Time
+	// Stored tiers compared with computed ones, set when tiers were replaced
+	Tiers *tierReport
+}
+
+func datasetVersion(jsonBytes []byte) string {
+	sum := sha256.Sum256(jsonBytes)
+	return hex.EncodeToString(sum[:6])
+}
+
+// Parses a snapshot. base overrides the starting elements marked in the
+// snapshot itself.
+func parseDataset(name string, jsonBytes []byte, base []string) (*dataset, error) {
+	var elements []Element
+	if err := json.Unmarshal(jsonBytes, &elements); err != nil {
+		return nil, fmt.Errorf("invalid dataset JSON: %w", err)
+	}
+	if err := markBase(elements, base); err != nil {
+		return nil, err
+	}
+	if err := validateElements(elements); err != nil {
+		return nil, err
+	}
+	version := datasetVersion(jsonBytes)
+	if len(base) > 0 {
+		version = datasetVersion([]byte(version + strings.Join(base, ",")))
+	}
+	return &dataset{
+		Name:     name,
+		Version:  version,
+		Elements: elements,
+		Base:     baseElements(elements),
+		LoadedAt: time.Now(),
+	}, nil
+}
+
+// Marks the starting elements. Explicit names win, then elements already
+// marked in the snapshot, then tier 0 and special elements without recipes.
+func markBase(elements []Element, names []string) error {
+	if len(names) > 0 {
+		known := make(map[string]bool, len(elements))
+		for i := range elements {
+			elements[i].Base = contains(names, elements[i].Name)
+			known[elements[i].Name] = true
+		}
+		for _, name := range names {
+			if !known[name] {
+				return fmt.Errorf("base element %q is not in the dataset", name)
+			}
+		}
+		return nil
+	}
+	for _, el := range elements {
+		if el.Base {
+			return nil
+		}
+	}
+	for i, el := range elements {
+		elements[i].Base = (el.Tier == 0 || el.Unlock != nil) && len(el.Recipes) == 0
+	}
+	return nil
+}
+
+func validateElements(elements []Element) error {
+	if len(elements) == 0 {
+		return fmt.Errorf("dataset has no elements")
+	}
+	names := make(map[string]bool, len(elements))
+	hasBase := false
+	for i, el := range elements {
+		if el.Name == "" {
+			return fmt.Errorf("element #%d has no name", i)
+		}
+		if names[el.Name] {
+			return fmt.Errorf("element %q is defined twice", el.Name)
+		}
+		if el.Tier < 0 {
+			return fmt.Errorf("element %q has negative tier %d", el.Name, el.Tier)
+		}
+		if err := validateCosts(el); err != nil {
+			return err
+		}
+		names[el.Name] = true
+		if el.Base {
+			hasBase = true
+		}
+	}
+	if !hasBase {
+		return fmt.Errorf("dataset has no base elements")
+	}
+	dangling := 0
+	for _, el := range elements {
+		for _, r := range el.Recipes {
+			for _, ing := range r {
+				if !names[ing] {
+					dangling++
+					break
+				}
+			}
+		}
+	}
+	if dangling > 0 {
+		fmt.Fprintf(os.Stderr, "Dataset has %d recipes with unknown ingredients, they will be ignored\n", dangling)
+	}
+	return nil
+}
+
+// Holds the active snapshot of one dataset and swaps it atomically on reload
+type datasetStore struct {
+	current atomic.Pointer[dataset]
+	// File the dataset was loaded from, empty when it was scraped
+	source   string
+	scraper  func() []Element
+	uploaded bool
+	// Starting elements overriding the ones in the snapshot
+	base []string
+	// Replace stored tiers with the computed crafting depth
+	computedTiers bool
+	reloadMu      sync.Mutex
+	onSwap        []func(old, ds *dataset)
+}
+
+func newDatasetStore(ds *dataset, source string) *datasetStore {
+	s := &datasetStore{source: source}
+	s.current.Store(ds)
+	return s
+}
+
+func (s *datasetStore) load() *dataset {
+	return s.current.Load()
+}
+
+func (s *datasetStore) swap(ds *dataset) {
+	old := s.current.Swap(ds)
+	fmt.Printf("Dataset %s swapped: %s -> %s (%d elements)\n", ds.Name, old.Version, ds.Version, len(ds.Elements))
+	for _, fn := range s.onSwap {
+		fn(old, ds)
+	}
+}
+
+// Loads a new snapshot from jsonBytes, or from the source when jsonBytes
+// is empty. Returns the active dataset, which is unchanged when the new
+// snapshot is identical.
+func (s *datasetStore) reload(jsonBytes []byte) (*dataset, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if len(jsonBytes) == 0 {
+		var err error
+		switch {
+		case s.source != "":
+			jsonBytes, err = os.ReadFile(s.source)
+		case s.scraper != nil:
+			jsonBytes, err = convertToJson(s.scraper())
+		default:
+			err = fmt.Errorf("dataset %s has no source to reload from", s.load().Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ds, err := parseDataset(s.load().Name, jsonBytes, s.base)
+	if err != nil {
+		return nil, err
+	}
+	if s.computedTiers {
+		ds = ds.withComputedTiers()
+	}
+	if current := s.load(); current.Version == ds.Version {
+		return current, nil
+	}
+	s.swap(ds)
+	return ds, nil
+}
+
+// Polls the source file and reloads when its modification time changes
+func (s *datasetStore) watchFile(interval time.Duration) {
+	if s.source == "" {
+		return
+	}
+	var lastMod time.Time
+	if info, err := os.Stat(s.source); err == nil {
+		lastMod = info.ModTime()
+	}
+	for range time.Tick(interval) {
+		info, err := os.Stat(s.source)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+		fmt.Printf("Dataset file %s changed, reloading\n", s.source)
+		if _, err := s.reload(nil); err != nil {
+			fmt.Println("Error reloading dataset:", err)
+		}
+	}
+}
+
+// Named datasets served side by side. Requests pick one with ?dataset=,
+// falling back to the default dataset.
+type datasetRegistry struct {
+	mu            sync.RWMutex
+	stores        map[string]*datasetStore
+	defaultName   string
+	computedTiers bool
+	onSwap        []func(old, ds *dataset)
+	// Called with the last dataset of a removed pack
+	onRemove []func(ds *dataset)
+}
+
+func newDatasetRegistry(defaultName string) *datasetRegistry {
+	return &datasetRegistry{
+		stores:      make(map[string]*datasetStore),
+		defaultName: defaultName,
+	}
+}
+
+func (reg *datasetRegistry) add(store *datasetStore) {
+	reg.prepare(store)
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.stores[store.load().Name] = store
+}
+
+// Adds store unless a store of the same name is registered, checked and
+// added under one lock. Returns the registered store and whether it is
+// store.
+func (reg *datasetRegistry) putIfAbsent(store *datasetStore) (*datasetStore, bool) {
+	reg.prepare(store)
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	name := store.load().Name
+	if existing, ok := reg.stores[name]; ok {
+		return existing, false
+	}
+	reg.stores[name] = store
+	return store, true
+}
+
+// Applies the registry's swap hooks and tiers to a store being added
+func (reg *datasetRegistry) prepare(store *datasetStore) {
+	store.onSwap = append(store.onSwap, reg.onSwap...)
+	if reg.computedTiers && !store.computedTiers {
+		store.computedTiers = true
+		store.current.Store(store.load().withComputedTiers())
+	}
+}
+
+func (reg *datasetRegistry) get(name string) (*datasetStore, bool) {
+	if name == "" {
+		name = reg.defaultName
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	store, ok := reg.stores[name]
+	return store, ok
+}
+
+func (reg *datasetRegistry) all() []*datasetStore {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	stores := make([]*datasetStore, 0, len(reg.stores))
+	for _, store := range reg.stores {
+		stores = append(stores, store)
+	}
+	sort.Slice(stores, func(i, j int) bool { return stores[i].load().Name < stores[j].load().Name })
+	return stores
+}
+
+// Resolves ?dataset= and writes a 404 when it is unknown
+func (reg *datasetRegistry) resolve(w http.ResponseWriter, r *http.Request) (*dataset, bool) {
+	name := r.URL.Query().Get("dataset")
+	store, ok := reg.get(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("dataset %q not found", name)})
+		return nil, false
+	}
+	ds := store.load()
+	w.Header().Set("X-Dataset", ds.Name)
+	w.Header().Set("X-Dataset-Version", ds.Version)
+	return ds, true
+}
+
+// Reloads every dataset on SIGHUP
+func (reg *datasetRegistry) watchSignals() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		fmt.Println("SIGHUP received, reloading datasets")
+		for _, store := range reg.all() {
+			if _, err := store.reload(nil); err != nil {
+				fmt.Printf("Error reloading dataset %s: %v\n", store.load().Name, err)
+			}
+		}
+	}
+}
+
+type datasetInfo struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Elements int       `json:"elements"`
+	Base     []string  `json:"base,omitempty"`
+	LoadedAt time.Time `json:"loadedAt"`
+	Source   string    `json:"source,omitempty"`
+	Default  bool      `json:"default"`
+}
+
+// GET /datasets
+func (reg *datasetRegistry) listHandler(w http.ResponseWriter, r *http.Request) {
+	infos := []datasetInfo{}
+	for _, store := range reg.all() {
+		ds := store.load()
+		infos = append(infos, datasetInfo{
+			Name:     ds.Name,
+			Version:  ds.Version,
+			Elements: len(ds.Elements),
+			Base:     ds.Base,
+			LoadedAt: ds.LoadedAt,
+			Source:   store.source,
+			Default:  ds.Name == reg.defaultName,
+		})
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// POST /admin/reload?dataset= with a snapshot body, or an empty body to
+// reload from the original source
+func (reg *datasetRegistry) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+	name := r.URL.Query().Get("dataset")
+	store, ok := reg.get(name)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("dataset %q not found", name)})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	previous := store.load().Version
+	ds, err := store.reload(body)
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("X-Dataset-Version", ds.Version)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dataset":         ds.Name,
+		"datasetVersion":  ds.Version,
+		"previousVersion": previous,
+		"elements":        len(ds.Elements),
+		"changed":         previous != ds.Version,
+	})
+}
+
+// GET /elements/{name}?dataset= returns the raw element
+func (reg *datasetRegistry) elementHandler(w http.ResponseWriter, r *http.Request) {
+	ds, ok := reg.resolve(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/elements/")
+	for _, el := range ds.Elements {
+		if el.Name == name {
+			writeJSON(w, http.StatusOK, el)
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+}
+
+// GET /export?dataset= downloads the whole snapshot
+func (reg *datasetRegistry) exportHandler(w http.ResponseWriter, r *http.Request) {
+	ds, ok := reg.resolve(w, r)
+	if !ok {
+		return
+	}
+	jsonBytes, err := convertToJson(ds.Elements)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ds.Name+".json"))
+	w.Write(jsonBytes)
+}
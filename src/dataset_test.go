@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testSnapshot(tb testing.TB, opts generatorOptions) []byte {
+	tb.Helper()
+	jsonBytes, err := convertToJson(testElements(tb, opts))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return jsonBytes
+}
+
+// Broken snapshots are refused, recipes with unknown ingredients are only
+// left out of the graph
+func TestParseDatasetValidation(t *testing.T) {
+	cases := map[string]string{
+		"not JSON":         `{`,
+		"empty":            `[]`,
+		"duplicate name":   `[{"name":"Air","base":true},{"name":"Air","base":true}]`,
+		"no name":          `[{"name":"Air","base":true},{"name":"","tier":1,"recipes":[["Air","Air"]]}]`,
+		"negative tier":    `[{"name":"Air","base":true},{"name":"Dust","tier":-1,"recipes":[["Air","Air"]]}]`,
+		"no base elements": `[{"name":"Dust","tier":1,"recipes":[["Dust","Dust"]]}]`,
+		"negative cost":    `[{"name":"Air","base":true,"cost":-1}]`,
+	}
+	for name, snapshot := range cases {
+		if _, err := parseDataset("test", []byte(snapshot), nil); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	snapshot := `[{"name":"Air","base":true},{"name":"Dust","tier":1,"recipes":[["Air","Air"],["Air","Smoke"]]}]`
+	ds, err := parseDataset("test", []byte(snapshot), nil)
+	if err != nil {
+		t.Fatalf("dangling ingredient: %v", err)
+	}
+	elementMap, _ := buildGraph(ds.Elements)
+	if recipes := elementMap["Dust"].Children; len(recipes) != 1 || recipes[0].String() != "Air + Air" {
+		t.Errorf("Dust has recipes %v, want Air + Air", recipes)
+	}
+}
+
+// Reloading swaps in a new version, keeps the dataset when the snapshot is
+// the same or invalid, and searches started before keep their snapshot
+func TestDatasetReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "elements.json")
+	first := testSnapshot(t, generatorOptions{Elements: 20, Base: 3, Tiers: 3, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Seed: 1})
+	if err := os.WriteFile(file, first, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := parseDataset("test", first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newDatasetStore(ds, file)
+	swaps := 0
+	store.onSwap = append(store.onSwap, func(old, ds *dataset) { swaps++ })
+
+	if got, err := store.reload(nil); err != nil || got != ds || swaps != 0 {
+		t.Errorf("same snapshot: %v, %d swaps", err, swaps)
+	}
+	if _, err := store.reload([]byte(`[]`)); err == nil || store.load() != ds {
+		t.Errorf("invalid snapshot: error %v, dataset replaced %t", err, store.load() != ds)
+	}
+
+	second := testSnapshot(t, generatorOptions{Elements: 20, Base: 3, Tiers: 3, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Seed: 2})
+	if err := os.WriteFile(file, second, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.reload(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version == ds.Version || store.load() != got || swaps != 1 {
+		t.Errorf("version %s after %s, %d swaps", got.Version, ds.Version, swaps)
+	}
+	if ds.Version != datasetVersion(first) {
+		t.Error("the old snapshot changed")
+	}
+}
+
+// POST /admin/reload swaps the snapshot searches answer from
+func TestReloadEndpoint(t *testing.T) {
+	mux := testMux(t, serverConfig{AdminToken: "secret"})
+	search := func() string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/BFS/T2E1?recipeAmount=1", nil))
+		return rec.Header().Get("X-Dataset-Version")
+	}
+	reload := func(method, body string) (int, map[string]any) {
+		req := httptest.NewRequest(method, "/admin/reload", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		var v map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		return rec.Code, v
+	}
+
+	before := search()
+	snapshot := testSnapshot(t, generatorOptions{Elements: 20, Base: 3, Tiers: 3, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Seed: 2})
+	code, v := reload(http.MethodPost, string(snapshot))
+	if code != http.StatusOK || v["changed"] != true || v["previousVersion"] != before {
+		t.Fatalf("reload: status %d, %v", code, v)
+	}
+	if after := search(); after != v["datasetVersion"] || after == before {
+		t.Errorf("searches answer from version %s, reloaded %v", after, v["datasetVersion"])
+	}
+	if code, v := reload(http.MethodPost, string(snapshot)); code != http.StatusOK || v["changed"] != false {
+		t.Errorf("same snapshot: status %d, %v", code, v)
+	}
+	if code, _ := reload(http.MethodPost, `[{"name":"Air","base":true},{"name":"Air"}]`); code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid snapshot: status %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ := reload(http.MethodGet, ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
+
+// Base elements come from the snapshot or the override, and every
+// algorithm stops at them
+func TestDatasetBaseElements(t *testing.T) {
+	snapshot := []byte(`[
+		{"name":"Air","tier":0},{"name":"Fire","tier":0},
+		{"name":"Time","tier":3,"unlock":{"discoveries":10}},
+		{"name":"Smoke","tier":1,"recipes":[["Air","Fire"]]},
+		{"name":"Cloud","tier":2,"recipes":[["Smoke","Air"]]},
+		{"name":"Age","tier":4,"recipes":[["Time","Cloud"]]}]`)
+	ds, err := parseDataset("test", snapshot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Air", "Fire", "Time"}; !reflect.DeepEqual(ds.Base, want) {
+		t.Errorf("base %v, want %v", ds.Base, want)
+	}
+
+	if _, err := parseDataset("test", snapshot, []string{"Air", "Nope"}); err == nil {
+		t.Error("no error for an unknown base element")
+	}
+	custom, err := parseDataset("test", snapshot, []string{"Air", "Smoke", "Time"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom.Version == ds.Version {
+		t.Error("overriding the base kept the version")
+	}
+	verifier := newTreeVerifier(custom.Elements)
+	for _, c := range benchCases {
+		opts := c
+		opts.Element = "Age"
+		opts.RecipeAmount = 1
+		tree, err := runSearch(quietContext(false), custom.Elements, opts, nil)
+		if err != nil || len(tree.Children) != 1 {
+			t.Fatalf("%s: %d trees, error %v", benchLabel(c), len(tree.Children), err)
+		}
+		for _, v := range verifier.verify(tree) {
+			t.Errorf("%s: %s", benchLabel(c), v)
+		}
+		// Smoke is a leaf, Fire is not reached
+		if got := treeKey(tree.Children[0]); got != "(Cloud(Air+Smoke)+Time)" {
+			t.Errorf("%s: tree %s", benchLabel(c), got)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -12,13 +15,72 @@ type ElementNode struct {
 	ImgSrc    string
 	Left      bool
 	Tier      int
-	Children  []*RecipeNode
+	IsBase    bool
+	// Discoveries needed before a special element becomes available
+	UnlockAfter int
+	// Cost of using the element as a leaf
+	Cost     float64
+	Children []*RecipeNode
 }
 
+// A recipe has one or more ingredients, the same element may appear twice
 type RecipeNode struct {
 	Result      string
-	Ingredient1 *ElementNode
-	Ingredient2 *ElementNode
+	Ingredients []*ElementNode
+	Cost        float64
+}
+
+// All ingredients exist and have a lower tier than the result
+func (recipe *RecipeNode) usableFor(tier int) bool {
+	if len(recipe.Ingredients) == 0 {
+		return false
+	}
+	for _, ing := range recipe.Ingredients {
+		if ing == nil || ing.Tier >= tier {
+			return false
+		}
+	}
+	return true
+}
+
+// Every ingredient has been reached already
+func (recipe *RecipeNode) discovered() bool {
+	for _, ing := range recipe.Ingredients {
+		if !ing.IsVisited {
+			return false
+		}
+	}
+	return true
+}
+
+func (recipe *RecipeNode) uses(el *ElementNode) bool {
+	for _, ing := range recipe.Ingredients {
+		if ing == el {
+			return true
+		}
+	}
+	return false
+}
+
+// buildGraph sorts ingredients, so the order they were listed in does not matter
+func (recipe *RecipeNode) sameIngredients(other *RecipeNode) bool {
+	if len(recipe.Ingredients) != len(other.Ingredients) {
+		return false
+	}
+	for i, ing := range recipe.Ingredients {
+		if ing.Name != other.Ingredients[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func (recipe *RecipeNode) String() string {
+	names := make([]string, len(recipe.Ingredients))
+	for i, ing := range recipe.Ingredients {
+		names[i] = ing.Name
+	}
+	return strings.Join(names, " + ")
 }
 
 type ExportableElement struct {
@@ -26,6 +88,8 @@ type ExportableElement struct {
 	ImgSrc     string             `json:"img_src"`
 	Attributes map[string]string  `json:"attributes"`
 	Children   []ExportableRecipe `json:"children"`
+	// Extra information about the whole result, only set on the root
+	Meta map[string]any `json:"meta,omitempty"`
 }
 
 type ExportableRecipe struct {
@@ -34,138 +98,178 @@ type ExportableRecipe struct {
 }
 
 var numberVisit int32
-var visitMu sync.Mutex
-var sem chan struct{}
-var recipeLeft int32
+
+// One element a live DFS visits or leaves. The search waits until the
+// consumer closes ack, so every step can be shown before the next one.
+type dfsStep struct {
+	Tier int
+	ack  chan struct{}
+}
+
+// Recipe budget and goroutine slots of one DFS_Multiple search, so several
+// searches can run at the same time. The search stops visiting elements
+// once ctx is done.
+type dfsSearch struct {
+	ctx        context.Context
+	recipeLeft int32
+	sem        chan struct{}
+	// Guards the nodes of the graph, written by every goroutine of the
+	// search. Live consumers hold it while they export the tree.
+	mu *sync.Mutex
+	// Paces a live search when not nil, see dfsStep
+	steps chan dfsStep
+}
+
+func newDFSSearch(ctx context.Context, recipeAmount int) *dfsSearch {
+	return &dfsSearch{
+		ctx:        ctx,
+		recipeLeft: int32(recipeAmount - 1),
+		sem:        make(chan struct{}, recipeAmount-1),
+		mu:         graphLock(ctx),
+	}
+}
+
+// Live search sending every step to steps, which is closed once the
+// search is done
+func newLiveDFSSearch(ctx context.Context, recipeAmount int) *dfsSearch {
+	s := newDFSSearch(ctx, recipeAmount)
+	s.steps = make(chan dfsStep)
+	return s
+}
+
+func (s *dfsSearch) stopped() bool {
+	return s.ctx.Err() != nil
+}
+
+// Reports the tier of a step to depthChan and waits for a live consumer
+// to acknowledge it. Must not be called while holding s.mu.
+func (s *dfsSearch) step(tier int, depthChan chan int) {
+	if depthChan != nil {
+		depthChan <- tier
+	}
+	if s.steps == nil {
+		return
+	}
+	ack := make(chan struct{})
+	select {
+	case s.steps <- dfsStep{Tier: tier, ack: ack}:
+	case <-s.ctx.Done():
+		return
+	}
+	select {
+	case <-ack:
+	case <-s.ctx.Done():
+	}
+}
+
+// Runs a live search from root and closes s.steps once every goroutine of
+// it is done
+func (s *dfsSearch) runLive(root *ElementNode, elements map[string]*ElementNode) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		DFS_Multiple(root, wg, elements, nil, s)
+	}()
+	go func() {
+		wg.Wait()
+		close(s.steps)
+	}()
+}
 
 func DFS_Multiple(
 	current *ElementNode,
 	wg *sync.WaitGroup,
 	elements map[string]*ElementNode,
 	depthChan chan int,
-	barrier *sync.WaitGroup,
+	search *dfsSearch,
 ) {
+	out := searchLog(search.ctx)
 	defer func() {
-		if depthChan != nil {
-			fmt.Printf("DFS_Multiple: %s\n", current.Name)
-			depthChan <- current.Tier
+		if depthChan != nil || search.steps != nil {
+			fmt.Fprintf(out, "DFS_Multiple: %s\n", current.Name)
+			search.step(current.Tier, depthChan)
 		}
 	}()
-	visitMu.Lock()
+	search.mu.Lock()
 	if current.IsVisited {
-		visitMu.Unlock()
-		if barrier != nil {
-			barrier.Done()
-		}
+		search.mu.Unlock()
 		return
 	}
 	current.IsVisited = true
-	visitMu.Unlock()
-
-	if current.Tier == 0 {
-		if barrier != nil {
-			barrier.Done()
-		}
+	if current.IsBase || search.stopped() {
+		search.mu.Unlock()
 		return
 	}
-
-	count := atomic.AddInt32(&numberVisit, 1)
-	fmt.Printf("Visiting node Multi (%d): %s Tier: %d RecipeLeft: %d\n", count, current.Name, current.Tier, atomic.LoadInt32(&recipeLeft))
-
-	// fmt.Printf("Recipe len: %d", len(current.Children))
 	ALLrecipes := make([]*RecipeNode, len(current.Children))
 	copy(ALLrecipes, current.Children)
 	current.Children = []*RecipeNode{}
+	search.mu.Unlock()
 
-	// fmt.Printf("Recipe len: %d", len(ALLrecipes))
-	if barrier != nil {
-		barrier.Done()
-		barrier.Wait()
-	}
+	count := atomic.AddInt32(&numberVisit, 1)
+	fmt.Fprintf(out, "Visiting node Multi (%d): %s Tier: %d RecipeLeft: %d\n", count, current.Name, current.Tier, atomic.LoadInt32(&search.recipeLeft))
 
-	if depthChan != nil {
-		fmt.Printf("DFS_Multiple: %s\n", current.Name)
-		depthChan <- current.Tier
+	if depthChan != nil || search.steps != nil {
+		fmt.Fprintf(out, "DFS_Multiple: %s\n", current.Name)
+		search.step(current.Tier, depthChan)
 	}
 
 	fistAdd := true
 	for _, recipe := range ALLrecipes {
+		if search.stopped() {
+			break
+		}
 		if recipe.Result != current.Name {
 			continue
 		}
 		// fmt.Printf("Processing recipe for %s\n", current.Name)
 
-		ing1 := recipe.Ingredient1
-		ing2 := recipe.Ingredient2
-		if ing1 == nil || ing2 == nil {
-			continue
-		}
-
-		if ing1.Tier >= current.Tier || ing2.Tier >= current.Tier {
+		if !recipe.usableFor(current.Tier) {
 			continue
 		}
 
 		if !fistAdd {
-			if atomic.LoadInt32(&recipeLeft) <= 0 {
+			if atomic.LoadInt32(&search.recipeLeft) <= 0 {
 				continue
 			}
-			atomic.AddInt32(&recipeLeft, -1)
+			atomic.AddInt32(&search.recipeLeft, -1)
 		}
 		fistAdd = false
 
-		visitMu.Lock()
+		allBase := true
+		search.mu.Lock()
 		current.Children = append(current.Children, recipe)
-		fmt.Printf("Appending recipe Multi for %s, %s + %s\n", current.Name, ing1.Name, ing2.Name)
-		visitMu.Unlock()
-
-		visitMu.Lock()
-		if ing1.Tier == 0 {
-			ing1.IsVisited = true
-		}
-		if ing2.Tier == 0 {
-			ing2.IsVisited = true
+		fmt.Fprintf(out, "Appending recipe Multi for %s, %s\n", current.Name, recipe)
+		for _, ing := range recipe.Ingredients {
+			if ing.IsBase {
+				ing.IsVisited = true
+			} else {
+				allBase = false
+			}
 		}
-		visitMu.Unlock()
+		search.mu.Unlock()
 
-		if ing1.Tier == 0 && ing2.Tier == 0 {
+		if allBase {
 			continue
 		}
-		if barrier != nil {
-			barrier.Add(1)
-		}
-		select {
-		case sem <- struct{}{}:
-			wg.Add(1)
-			go func(n *ElementNode) {
-				defer wg.Done()
-				DFS_Multiple(n, wg, elements, depthChan, barrier)
-				<-sem // release slot
-			}(ing1)
-		default:
-			DFS_Multiple(ing1, wg, elements, depthChan, barrier)
-		}
-		if barrier != nil {
-			barrier.Add(1)
-		}
-		select {
-		case sem <- struct{}{}:
-			wg.Add(1)
-			go func(n *ElementNode) {
-				defer wg.Done()
-				DFS_Multiple(n, wg, elements, depthChan, barrier)
-				<-sem // release slot
-			}(ing2)
-		default:
-			DFS_Multiple(ing2, wg, elements, depthChan, barrier)
+		for _, ing := range recipe.Ingredients {
+			select {
+			case search.sem <- struct{}{}:
+				wg.Add(1)
+				go func(n *ElementNode) {
+					defer wg.Done()
+					DFS_Multiple(n, wg, elements, depthChan, search)
+					<-search.sem // release slot
+				}(ing)
+			default:
+				DFS_Multiple(ing, wg, elements, depthChan, search)
+			}
 		}
 	}
 
 	// if len(current.Children) == 0 {
 	// 	DFS_Single(current, wg, elements, depthChan)
 	// }
-	visitMu.Lock()
-	current.IsVisited = true
-	visitMu.Unlock()
 }
 
 // func DFS_Single(
@@ -326,8 +430,11 @@ func ToExportableElement(node *ElementNode, res *ExportableElement, visited map[
 		fmt.Printf("Left: %s\n", node.Name)
 	}
 	res.Attributes["Type"] = "element"
+	if node.UnlockAfter > 0 {
+		res.Attributes["UnlockAfter"] = strconv.Itoa(node.UnlockAfter)
+	}
 
-	if node.Tier == 0 {
+	if node.IsBase {
 		return
 	}
 
@@ -342,9 +449,10 @@ func ToExportableRecipe(node *RecipeNode, res *ExportableRecipe, visited map[*El
 		return
 	}
 	res.Attributes = "recipe"
-	res.Children = make([]ExportableElement, 2)
-	ToExportableElement(node.Ingredient1, &res.Children[0], visited)
-	ToExportableElement(node.Ingredient2, &res.Children[1], visited)
+	res.Children = make([]ExportableElement, len(node.Ingredients))
+	for i, ing := range node.Ingredients {
+		ToExportableElement(ing, &res.Children[i], visited)
+	}
 }
 
 func ToExportableElement3(node *ElementNode, visited map[*ElementNode]*ExportableElement) *ExportableElement {
@@ -381,7 +489,7 @@ func ToExportableElement3(node *ElementNode, visited map[*ElementNode]*Exportabl
 	// Put early in map to avoid recursive cycles
 	visited[node] = exported
 
-	if node.Tier != 0 {
+	if !node.IsBase {
 		for _, recipeNode := range node.Children {
 			exported.Children = append(exported.Children, *ToExportableRecipe3(recipeNode, visited))
 		}
@@ -395,13 +503,11 @@ func ToExportableRecipe3(recipe *RecipeNode, visited map[*ElementNode]*Exportabl
 		return nil
 	}
 
-	return &ExportableRecipe{
-		Attributes: "recipe",
-		Children: []ExportableElement{
-			*ToExportableElement3(recipe.Ingredient1, visited),
-			*ToExportableElement3(recipe.Ingredient2, visited),
-		},
+	exported := &ExportableRecipe{Attributes: "recipe"}
+	for _, ing := range recipe.Ingredients {
+		exported.Children = append(exported.Children, *ToExportableElement3(ing, visited))
 	}
+	return exported
 }
 
 // func ToExportableElement(node ElementNode, res *ExportableElement, visited map[string]ExportableElement) {
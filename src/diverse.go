@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Picking diverse trees compares every candidate with every picked tree
+const maxDiverseAmount = 200
+
+// Levels below the result whose elements get all their recipes as
+// candidates, deeper ones keep the recipes the search explored
+const diverseDepth = 2
+
+// One recipe of a tree, by its index in a recipeIDs table
+type weightedRecipe struct {
+	id     int
+	weight float64
+}
+
+// Recipes of a tree weighted by the shallowest level they are used at,
+// halving per level so that differences near the result count the most.
+// Sorted by id, ids shared by every tree compared.
+func treeWeights(name string, recipe ExportableRecipe, recipeIDs map[string]int) []weightedRecipe {
+	weights := make(map[int]float64)
+	var walk func(name string, recipe ExportableRecipe, weight float64)
+	walk = func(name string, recipe ExportableRecipe, weight float64) {
+		names := make([]string, len(recipe.Children))
+		for i, ing := range recipe.Children {
+			names[i] = ing.Name
+		}
+		key := name + "=" + strings.Join(names, "+")
+		id, ok := recipeIDs[key]
+		if !ok {
+			id = len(recipeIDs)
+			recipeIDs[key] = id
+		}
+		weights[id] = max(weights[id], weight)
+		for _, ing := range recipe.Children {
+			for _, sub := range ing.Children {
+				walk(ing.Name, sub, weight/2)
+			}
+		}
+	}
+	walk(name, recipe, 1)
+	sorted := make([]weightedRecipe, 0, len(weights))
+	for id, w := range weights {
+		sorted = append(sorted, weightedRecipe{id, w})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted
+}
+
+// Weighted Jaccard similarity of two trees, 1 when they are the same and 0
+// when they share no recipe
+func treeSimilarity(a, b []weightedRecipe) float64 {
+	shared, total := 0.0, 0.0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].id < b[j].id):
+			total += a[i].weight
+			i++
+		case i == len(a) || b[j].id < a[i].id:
+			total += b[j].weight
+			j++
+		default:
+			shared += min(a[i].weight, b[j].weight)
+			total += max(a[i].weight, b[j].weight)
+			i++
+			j++
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return shared / total
+}
+
+// Gives the elements near root every recipe that has a tree
+func (c *treeCollector) widen(node *ElementNode, depth int, seen map[*ElementNode]bool) {
+	if depth >= diverseDepth || node.IsBase || seen[node] {
+		return
+	}
+	seen[node] = true
+	for _, recipe := range c.recipes[node] {
+		if c.completable(recipe, node.Tier) && !hasRecipe(node.Children, recipe) {
+			node.Children = append(node.Children, recipe)
+			for _, ing := range recipe.Ingredients {
+				c.complete(ing, make(map[*ElementNode]bool))
+			}
+		}
+	}
+	for _, recipe := range node.Children {
+		for _, ing := range recipe.Ingredients {
+			c.widen(ing, depth+1, seen)
+		}
+	}
+}
+
+// Like collect, but picks the trees that differ the most instead of the
+// first ones found. Every recipe of the result is a candidate, so the trees
+// start with distinct recipes whenever the element has enough of them, then
+// each next tree is the candidate least similar to the closest picked one.
+func (c *treeCollector) collectDiverse(root *ElementNode, limit int) ExportableElement {
+	c.complete(root, make(map[*ElementNode]bool))
+	c.topUp(root, limit)
+	c.widen(root, 0, make(map[*ElementNode]bool))
+
+	// Up to limit trees starting with each recipe of root
+	var candidates []ExportableRecipe
+	recipes := root.Children
+	for _, recipe := range recipes {
+		root.Children = []*RecipeNode{recipe}
+		candidates = append(candidates, extractTrees(root, limit).Children...)
+	}
+	root.Children = recipes
+
+	recipeIDs := make(map[string]int)
+	weights := make([][]weightedRecipe, len(candidates))
+	for i, tree := range candidates {
+		weights[i] = treeWeights(root.Name, tree, recipeIDs)
+	}
+	var picked []int
+	// Similarity of every candidate to the closest picked tree
+	closest := make([]float64, len(candidates))
+	taken := make([]bool, len(candidates))
+	for len(picked) < min(limit, len(candidates)) {
+		next := -1
+		for i := range candidates {
+			if !taken[i] && (next < 0 || closest[i] < closest[next]) {
+				next = i
+			}
+		}
+		taken[next] = true
+		picked = append(picked, next)
+		for i := range candidates {
+			closest[i] = max(closest[i], treeSimilarity(weights[i], weights[next]))
+		}
+	}
+
+	result := exportLeaf(root)
+	result.Children = []ExportableRecipe{}
+	for _, i := range picked {
+		result.Children = append(result.Children, candidates[i])
+	}
+	result.Meta = map[string]any{
+		"trees":          len(result.Children),
+		"treesAvailable": c.full.count(root).String(),
+		"diversity":      diversityMeta(root.Name, result.Children),
+	}
+	if root.IsBase {
+		result.Meta["trees"] = 1
+	}
+	return result
+}
+
+// Pairwise similarity of the returned trees, with its mean and maximum
+// over distinct pairs and the number of distinct recipes of the result
+func diversityMeta(name string, trees []ExportableRecipe) map[string]any {
+	recipeIDs := make(map[string]int)
+	weights := make([][]weightedRecipe, len(trees))
+	firstRecipes := make(map[string]bool)
+	for i, tree := range trees {
+		weights[i] = treeWeights(name, tree, recipeIDs)
+		names := make([]string, len(tree.Children))
+		for j, ing := range tree.Children {
+			names[j] = ing.Name
+		}
+		firstRecipes[strings.Join(names, "+")] = true
+	}
+	matrix := make([][]float64, len(trees))
+	sum, highest, pairs := 0.0, 0.0, 0
+	for i := range trees {
+		matrix[i] = make([]float64, len(trees))
+		for j := range trees {
+			s := math.Round(treeSimilarity(weights[i], weights[j])*1000) / 1000
+			matrix[i][j] = s
+			if j > i {
+				sum += s
+				highest = max(highest, s)
+				pairs++
+			}
+		}
+	}
+	mean := 0.0
+	if pairs > 0 {
+		mean = math.Round(sum/float64(pairs)*1000) / 1000
+	}
+	return map[string]any{
+		"similarity":     matrix,
+		"meanSimilarity": mean,
+		"maxSimilarity":  highest,
+		"firstRecipes":   len(firstRecipes),
+	}
+}
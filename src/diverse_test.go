@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+// X is A+B, where A has three recipes, or C+D
+var diverseElements = []Element{
+	{Name: "P", Base: true},
+	{Name: "Q", Base: true},
+	{Name: "R", Base: true},
+	{Name: "S", Base: true},
+	{Name: "A", Tier: 1, Recipes: [][]string{{"P", "Q"}, {"P", "R"}, {"Q", "R"}}},
+	{Name: "B", Tier: 1, Recipes: [][]string{{"P", "S"}}},
+	{Name: "C", Tier: 1, Recipes: [][]string{{"R", "S"}}},
+	{Name: "D", Tier: 1, Recipes: [][]string{{"Q", "S"}}},
+	{Name: "X", Tier: 2, Recipes: [][]string{{"A", "B"}, {"C", "D"}}},
+}
+
+// Differences near the result weigh more than deep ones
+func TestTreeSimilarity(t *testing.T) {
+	leaf := func(name string) ExportableElement { return ExportableElement{Name: name} }
+	made := func(name string, ings ...ExportableElement) ExportableElement {
+		return ExportableElement{Name: name, Children: []ExportableRecipe{{Children: ings}}}
+	}
+	trees := map[string]ExportableRecipe{
+		"AB": {Children: []ExportableElement{made("A", leaf("P"), leaf("Q")), made("B", leaf("P"), leaf("S"))}},
+		// Same first recipe, A made another way
+		"AB'": {Children: []ExportableElement{made("A", leaf("P"), leaf("R")), made("B", leaf("P"), leaf("S"))}},
+		"CD":  {Children: []ExportableElement{made("C", leaf("R"), leaf("S")), made("D", leaf("Q"), leaf("S"))}},
+	}
+	ids := make(map[string]int)
+	weights := make(map[string][]weightedRecipe)
+	for name, tree := range trees {
+		weights[name] = treeWeights("X", tree, ids)
+	}
+	if s := treeSimilarity(weights["AB"], weights["AB"]); s != 1 {
+		t.Errorf("a tree with itself: %g, want 1", s)
+	}
+	if s := treeSimilarity(weights["AB"], weights["CD"]); s != 0 {
+		t.Errorf("trees sharing no recipe: %g, want 0", s)
+	}
+	if s := treeSimilarity(weights["AB"], weights["AB'"]); s <= 0.5 || s >= 1 {
+		t.Errorf("trees differing one level down: %g, want between 0.5 and 1", s)
+	}
+}
+
+// Diverse results start with every recipe of the element before repeating
+// one, for every algorithm, and report how similar they are
+func TestDiverseTrees(t *testing.T) {
+	for _, c := range benchCases {
+		opts := c
+		opts.Element = "X"
+		opts.RecipeAmount = 2
+		opts.Diverse = true
+		tree, err := runSearch(quietContext(false), diverseElements, opts, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", benchLabel(c), err)
+		}
+		if len(tree.Children) != 2 {
+			t.Fatalf("%s: %d trees, want 2", benchLabel(c), len(tree.Children))
+		}
+		first := make(map[string]bool)
+		for _, recipe := range tree.Children {
+			first[recipe.Children[0].Name] = true
+		}
+		if !first["A"] || !first["C"] {
+			t.Errorf("%s: trees start with %v, want A+B and C+D", benchLabel(c), first)
+		}
+		diversity := tree.Meta["diversity"].(map[string]any)
+		matrix := diversity["similarity"].([][]float64)
+		if diversity["firstRecipes"] != 2 || matrix[0][0] != 1 || matrix[0][1] != 0 || diversity["maxSimilarity"] != 0.0 {
+			t.Errorf("%s: diversity %v", benchLabel(c), diversity)
+		}
+	}
+
+	opts := SearchOptions{Element: "X", Algorithm: "BFS", RecipeAmount: maxDiverseAmount + 1, Diverse: true}
+	if _, err := runSearch(quietContext(false), diverseElements, opts, nil); err == nil {
+		t.Error("no error for too many diverse trees")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Shape of a synthetic dataset, the same options and seed always give the
+// same elements
+type generatorOptions struct {
+	Elements int
+	Base     int
+	Tiers    int
+	// Recipes per element, each element gets between 1 and Recipes
+	Recipes int
+	// Ingredients per recipe
+	MinIngredients int
+	MaxIngredients int
+	// Deliberate defects: cycles, a recipe of A using B and one of B using
+	// A with B of the same or a higher tier than A, and recipes using an
+	// ingredient that does not exist
+	Cycles   int
+	Dangling int
+	Seed     int64
+}
+
+func (o generatorOptions) validate() error {
+	switch {
+	case o.Base < 1:
+		return fmt.Errorf("need at least one base element")
+	case o.Tiers < 1:
+		return fmt.Errorf("need at least one tier")
+	case o.Elements-o.Base < o.Tiers:
+		return fmt.Errorf("%d elements cannot fill %d base elements and %d tiers", o.Elements, o.Base, o.Tiers)
+	case o.Recipes < 1:
+		return fmt.Errorf("need at least one recipe per element")
+	case o.MinIngredients < 1 || o.MaxIngredients < o.MinIngredients:
+		return fmt.Errorf("invalid ingredient range %d-%d", o.MinIngredients, o.MaxIngredients)
+	case o.Cycles < 0 || o.Dangling < 0:
+		return fmt.Errorf("defect counts cannot be negative")
+	}
+	return nil
+}
+
+// Builds a random recipe graph. Elements are spread evenly over the tiers
+// and every element has a recipe using the tier right below it, so the
+// stored tiers match the computed crafting depth. Recipes of one element
+// are distinct.
+func generateElements(opts generatorOptions) ([]Element, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewPCG(uint64(opts.Seed), 0))
+
+	var elements []Element
+	byTier := make([][]int, opts.Tiers+1)
+	for i := 0; i < opts.Base; i++ {
+		byTier[0] = append(byTier[0], len(elements))
+		elements = append(elements, Element{Name: fmt.Sprintf("Base%d", i+1), Base: true})
+	}
+	rest := opts.Elements - opts.Base
+	for tier := 1; tier <= opts.Tiers; tier++ {
+		// Spread the remainder over the lowest tiers
+		n := rest / opts.Tiers
+		if tier <= rest%opts.Tiers {
+			n++
+		}
+		for i := 0; i < n; i++ {
+			byTier[tier] = append(byTier[tier], len(elements))
+			elements = append(elements, Element{Name: fmt.Sprintf("T%dE%d", tier, i+1), Tier: tier})
+		}
+	}
+
+	// Random element of a tier in [lo, hi]
+	pick := func(lo, hi int) string {
+		var pool []int
+		for t := lo; t <= hi; t++ {
+			pool = append(pool, byTier[t]...)
+		}
+		return elements[pool[rng.IntN(len(pool))]].Name
+	}
+	ingredientCount := func() int {
+		return opts.MinIngredients + rng.IntN(opts.MaxIngredients-opts.MinIngredients+1)
+	}
+
+	for tier := 1; tier <= opts.Tiers; tier++ {
+		for _, idx := range byTier[tier] {
+			el := &elements[idx]
+			seen := make(map[string]bool)
+			want := 1 + rng.IntN(opts.Recipes)
+			// Small graphs may not have enough combinations, give up after
+			// a few misses instead of looping forever
+			for attempts := 0; len(el.Recipes) < want && attempts < want*10; attempts++ {
+				recipe := make([]string, ingredientCount())
+				for i := range recipe {
+					recipe[i] = pick(0, tier-1)
+				}
+				if len(el.Recipes) == 0 {
+					recipe[0] = pick(tier-1, tier-1)
+				}
+				key := recipeKey(el.Name, recipe)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				el.Recipes = append(el.Recipes, recipe)
+			}
+		}
+	}
+
+	// Defects go on crafted elements so the base elements stay clean
+	crafted := opts.Elements - opts.Base
+	// Recipe of el using first, completed with lower tier ingredients
+	addDefect := func(el *Element, first string) {
+		recipe := []string{first}
+		for n := ingredientCount(); len(recipe) < n; {
+			recipe = append(recipe, pick(0, el.Tier-1))
+		}
+		el.Recipes = append(el.Recipes, recipe)
+	}
+	for i := 0; i < opts.Cycles; i++ {
+		a := opts.Base + rng.IntN(crafted)
+		var pool []int
+		for t := elements[a].Tier; t <= opts.Tiers; t++ {
+			for _, idx := range byTier[t] {
+				if idx != a {
+					pool = append(pool, idx)
+				}
+			}
+		}
+		// Alone in the highest tier, the element uses itself
+		b := a
+		if len(pool) > 0 {
+			b = pool[rng.IntN(len(pool))]
+		}
+		addDefect(&elements[a], elements[b].Name)
+		if b != a {
+			addDefect(&elements[b], elements[a].Name)
+		}
+	}
+	for i := 0; i < opts.Dangling; i++ {
+		addDefect(&elements[opts.Base+rng.IntN(crafted)], fmt.Sprintf("Missing%d", i+1))
+	}
+	return elements, nil
+}
+
+// Parses "2" or "1-3"
+func parseRange(s string) (int, int, error) {
+	lo, hi, found := strings.Cut(s, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	if !found {
+		return min, min, nil
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(hi))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return min, max, nil
+}
+
+// generate writes a synthetic dataset snapshot for tests, fuzzing and load
+func generateCommand(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	opts := generatorOptions{}
+	fs.IntVar(&opts.Elements, "elements", 200, "total number of elements, base elements included")
+	fs.IntVar(&opts.Base, "base", 4, "number of base elements")
+	fs.IntVar(&opts.Tiers, "tiers", 10, "number of tiers above the base elements")
+	fs.IntVar(&opts.Recipes, "recipes", 3, "maximum number of recipes per element")
+	branching := fs.String("branching", "2", "ingredients per recipe, a number or a range like 1-3")
+	fs.IntVar(&opts.Cycles, "cycles", 0, "pairs of recipes making two elements out of each other")
+	fs.IntVar(&opts.Dangling, "dangling", 0, "recipes added with an ingredient that does not exist")
+	fs.Int64Var(&opts.Seed, "seed", 1, "random seed")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	var err error
+	if opts.MinIngredients, opts.MaxIngredients, err = parseRange(*branching); err != nil {
+		return err
+	}
+	elements, err := generateElements(opts)
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := w.Write(jsonBytes); err != nil {
+		return err
+	}
+	recipes := 0
+	for _, el := range elements {
+		recipes += len(el.Recipes)
+	}
+	fmt.Fprintf(os.Stderr, "Generated %d elements with %d recipes (seed %d)\n", len(elements), recipes, opts.Seed)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+)
+
+// Iterative deepening DFS: depth limited searches with a growing limit, so
+// the first tree found is a shallowest one while memory stays that of a
+// DFS. A recipe lowers the tier, so no tree is deeper than the root's tier.
+// onIteration, if not nil, is called after every iteration with its limit,
+// while the graph is not being changed. Stops without a tree once ctx is
+// done.
+func iddfs(ctx context.Context, root *ElementNode, onIteration func(limit int)) bool {
+	// Recipes of every expanded node, its Children only hold the recipe it
+	// was solved with
+	recipes := make(map[*ElementNode][]*RecipeNode)
+	// Largest depth limit a node failed with, it fails with any lower one
+	failed := make(map[*ElementNode]int)
+	// Height of the tree a node was solved with
+	height := make(map[*ElementNode]int)
+
+	var search func(node *ElementNode, limit int) bool
+	search = func(node *ElementNode, limit int) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if !node.IsVisited {
+			node.IsVisited = true
+			if !node.IsBase {
+				recipes[node] = node.Children
+				node.Children = nil
+			}
+		}
+		if node.IsBase {
+			return true
+		}
+		if h, ok := height[node]; ok && h <= limit {
+			return true
+		}
+		if f, ok := failed[node]; (ok && f >= limit) || limit == 0 {
+			return false
+		}
+		for _, recipe := range recipes[node] {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			solved := true
+			h := 0
+			for _, ing := range recipe.Ingredients {
+				if !search(ing, limit-1) {
+					solved = false
+					break
+				}
+				h = max(h, height[ing])
+			}
+			if solved {
+				node.Children = []*RecipeNode{recipe}
+				height[node] = h + 1
+				return true
+			}
+		}
+		failed[node] = limit
+		return false
+	}
+
+	for limit := 0; limit <= max(root.Tier, 0) && ctx.Err() == nil; limit++ {
+		found := search(root, limit)
+		if onIteration != nil {
+			onIteration(limit)
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxImageSize = 512
+
+// Element icons mirrored to a local directory, one file per element
+type imageStore struct {
+	dir string
+}
+
+// File names keep letters, digits, '-' and '_' so any element name is safe,
+// and end with a hash of the name so two names never share a file
+func imageKey(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	sum := sha256.Sum256([]byte(name))
+	return b.String() + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Extensions of mirrored icons, in lookup order
+var imageExtensions = []string{".png", ".svg", ".webp", ".jpg", ".gif"}
+
+// Empty for content that is not a supported image
+func imageExtension(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ""
+}
+
+// Returns the mirrored file of an element, empty when there is none
+func (s *imageStore) path(name string) string {
+	key := imageKey(name)
+	for _, ext := range imageExtensions {
+		path := filepath.Join(s.dir, key+ext)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
+
+func (s *imageStore) download(client *http.Client, el Element) error {
+	resp, err := client.Get(el.ImgSrc)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", el.ImgSrc, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	ext := imageExtension(contentType)
+	if ext == "" {
+		return fmt.Errorf("%s is not a supported image (%s)", el.ImgSrc, contentType)
+	}
+	key := imageKey(el.Name)
+	target := filepath.Join(s.dir, key+ext)
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	// A new download replaces an icon of another format
+	for _, other := range imageExtensions {
+		if other != ext {
+			os.Remove(filepath.Join(s.dir, key+other))
+		}
+	}
+	return nil
+}
+
+type mirrorStats struct {
+	Downloaded int
+	Skipped    int
+	NoImage    int
+	Failed     []string
+}
+
+// Downloads the icon of every element that is not mirrored yet
+func (s *imageStore) mirror(elements []Element, workers int, force bool) (mirrorStats, error) {
+	var stats mirrorStats
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return stats, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(workers, 1))
+	for _, el := range elements {
+		if el.ImgSrc == "" {
+			stats.NoImage++
+			continue
+		}
+		if !force && s.path(el.Name) != "" {
+			stats.Skipped++
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(el Element) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := s.download(client, el)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Printf("Error mirroring %s: %v\n", el.Name, err)
+				stats.Failed = append(stats.Failed, el.Name)
+				return
+			}
+			stats.Downloaded++
+		}(el)
+	}
+	wg.Wait()
+	return stats, nil
+}
+
+// Nearest neighbour scaling so the longest side is size pixels
+func resizeImage(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return src
+	}
+	dw, dh := size, size
+	if w > h {
+		dh = max(h*size/w, 1)
+	} else {
+		dw = max(w*size/h, 1)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy := b.Min.Y + y*h/dh
+		for x := 0; x < dw; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*w/dw, sy))
+		}
+	}
+	return dst
+}
+
+// Plain square shown when an element has no icon at all
+func placeholderImage(size int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	fill := color.NRGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+	border := color.NRGBA{R: 0x99, G: 0x99, B: 0x99, A: 0xff}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x == 0 || y == 0 || x == size-1 || y == size-1 {
+				img.Set(x, y, border)
+			} else {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func writeImage(w http.ResponseWriter, r *http.Request, data []byte, contentType string) {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// Hosts the scrapers take icons from, the only ones served by redirect
+var remoteImageHosts = []string{"static.wikia.nocookie.net", "vignette.wikia.nocookie.net"}
+
+// Whether src is an http(s) URL on a host of remoteImageHosts. Uploaded
+// packs can set any img_src, redirecting to it would be an open redirect.
+func remoteImage(src string) bool {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil {
+		return false
+	}
+	return contains(remoteImageHosts, strings.ToLower(u.Hostname()))
+}
+
+// GET /api/images/{name}?dataset=&size= serves a mirrored icon, resized
+// when size is set. Icons that are not mirrored redirect to the original
+// URL when it is on a scraped host, other elements get a placeholder.
+func imageHandler(store *imageStore, registry *datasetRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/api/images/")
+		if name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "element name is required"})
+			return
+		}
+		size := 0
+		if s := r.URL.Query().Get("size"); s != "" {
+			var err error
+			size, err = strconv.Atoi(s)
+			if err != nil || size < 1 || size > maxImageSize {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("size must be between 1 and %d", maxImageSize)})
+				return
+			}
+		}
+
+		if path := store.path(name); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			contentType := mime.TypeByExtension(filepath.Ext(path))
+			if contentType == "" {
+				contentType = http.DetectContentType(data)
+			}
+			if size > 0 {
+				// Formats the standard library cannot decode are served as is
+				if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+					var buf bytes.Buffer
+					if err := png.Encode(&buf, resizeImage(img, size)); err == nil {
+						data, contentType = buf.Bytes(), "image/png"
+					}
+				}
+			}
+			w.Header().Set("X-Image-Source", "local")
+			writeImage(w, r, data, contentType)
+			return
+		}
+
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
+		}
+		var found *Element
+		for i := range ds.Elements {
+			if ds.Elements[i].Name == name {
+				found = &ds.Elements[i]
+				break
+			}
+		}
+		if found == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+			return
+		}
+		if remoteImage(found.ImgSrc) && r.URL.Query().Get("fallback") != "placeholder" {
+			w.Header().Set("X-Image-Source", "remote")
+			http.Redirect(w, r, found.ImgSrc, http.StatusFound)
+			return
+		}
+		if size == 0 {
+			size = 64
+		}
+		w.Header().Set("X-Image-Source", "placeholder")
+		writeImage(w, r, placeholderImage(size), "image/png")
+	}
+}
+
+type mosaicTile struct {
+	Name   string `json:"name"`
+	Tier   int    `json:"tier"`
+	ImgSrc string `json:"img_src"`
+}
+
+// GET /image?count=&seed=&minTier=&maxTier=&exclude=A,B picks elements with
+// an icon for the background mosaic. The same seed and dataset always give
+// the same ordered list; without a seed one is chosen and returned.
+func mosaicHandler(registry *datasetRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		intParam := func(name string, def int64) (int64, bool) {
+			v := query.Get(name)
+			if v == "" {
+				return def, true
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("%s must be an integer", name)})
+				return 0, false
+			}
+			return n, true
+		}
+		count, ok := intParam("count", 50)
+		if !ok {
+			return
+		}
+		seed, ok := intParam("seed", randomSeed())
+		if !ok {
+			return
+		}
+		minTier, ok := intParam("minTier", 0)
+		if !ok {
+			return
+		}
+		maxTier, ok := intParam("maxTier", math.MaxInt32)
+		if !ok {
+			return
+		}
+		if count < 0 || minTier > maxTier {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "count must not be negative and minTier must not exceed maxTier"})
+			return
+		}
+		exclude := splitList(query.Get("exclude"))
+
+		// Sorting first keeps the result independent of the snapshot order
+		var tiles []mosaicTile
+		for _, el := range ds.Elements {
+			if el.ImgSrc == "" || int64(el.Tier) < minTier || int64(el.Tier) > maxTier || contains(exclude, el.Name) {
+				continue
+			}
+			tiles = append(tiles, mosaicTile{Name: el.Name, Tier: el.Tier, ImgSrc: el.ImgSrc})
+		}
+		sort.Slice(tiles, func(i, j int) bool { return tiles[i].Name < tiles[j].Name })
+		rng := rand.New(rand.NewPCG(uint64(seed), 0))
+		rng.Shuffle(len(tiles), func(i, j int) { tiles[i], tiles[j] = tiles[j], tiles[i] })
+		if int64(len(tiles)) > count {
+			tiles = tiles[:count]
+		}
+		if tiles == nil {
+			tiles = []mosaicTile{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"seed":     seed,
+			"count":    len(tiles),
+			"elements": tiles,
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Names that sanitize to the same characters still get their own file
+func TestImageKeyCollisions(t *testing.T) {
+	names := []string{"Fire Water", "Fire_Water", "Fire/Water", "Fire?Water", "fire water"}
+	seen := make(map[string]string)
+	for _, name := range names {
+		key := imageKey(name)
+		if other, ok := seen[key]; ok {
+			t.Errorf("%q and %q share the key %q", name, other, key)
+		}
+		seen[key] = name
+		if key != imageKey(name) {
+			t.Errorf("key of %q changes between calls", name)
+		}
+	}
+}
+
+// Leftovers of interrupted downloads are never served
+func TestImageStorePath(t *testing.T) {
+	store := &imageStore{dir: t.TempDir()}
+	write := func(file string) {
+		if err := os.WriteFile(filepath.Join(store.dir, file), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := imageKey("Steam")
+	write(key + ".png.tmp")
+	write(key + ".tmp")
+	if path := store.path("Steam"); path != "" {
+		t.Errorf("path %q for a partial download", path)
+	}
+	write(key + ".webp")
+	if path, want := store.path("Steam"), filepath.Join(store.dir, key+".webp"); path != want {
+		t.Errorf("path %q, want %q", path, want)
+	}
+	if path := store.path("Steam "); path != "" {
+		t.Errorf("path %q for another element", path)
+	}
+}
+
+// The same seed gives the same ordered list, and a chosen seed survives
+// JSON numbers so it can be sent back
+func TestMosaicSeed(t *testing.T) {
+	elements := testElements(t, generatorOptions{Elements: 40, Base: 4, Tiers: 5, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Seed: 3})
+	for i := range elements {
+		elements[i].ImgSrc = "https://example.com/" + elements[i].Name + ".png"
+	}
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := parseDataset("test", jsonBytes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newDatasetRegistry("test")
+	registry.add(newDatasetStore(ds, ""))
+	handler := mosaicHandler(registry)
+
+	type mosaic struct {
+		Seed     json.Number  `json:"seed"`
+		Elements []mosaicTile `json:"elements"`
+	}
+	get := func(query string) mosaic {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/image?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, rec.Code, rec.Body.String())
+		}
+		dec := json.NewDecoder(rec.Body)
+		dec.UseNumber()
+		var m mosaic
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	first := get("count=20")
+	seed, err := first.Seed.Int64()
+	if err != nil || seed < 0 || seed >= 1<<53 {
+		t.Fatalf("seed %s is not an integer below 2^53", first.Seed)
+	}
+	again := get("count=20&seed=" + first.Seed.String())
+	if !reflect.DeepEqual(first.Elements, again.Elements) {
+		t.Errorf("seed %s gave\n%v\nthen\n%v", first.Seed, first.Elements, again.Elements)
+	}
+	if len(first.Elements) != 20 {
+		t.Errorf("%d elements, want 20", len(first.Elements))
+	}
+	if other := get("count=20&seed=" + strconv.FormatInt(seed+1, 10)); reflect.DeepEqual(first.Elements, other.Elements) {
+		t.Errorf("seeds %d and %d gave the same list", seed, seed+1)
+	}
+}
+
+// Icons that are not mirrored redirect only to the hosts the scrapers use,
+// any other img_src of an uploaded pack gets the placeholder
+func TestImageRedirectHosts(t *testing.T) {
+	cases := map[string]bool{
+		"https://static.wikia.nocookie.net/little-alchemy/images/a/a1/Air.svg": true,
+		"http://vignette.wikia.nocookie.net/little-alchemy/images/Fire.png":    true,
+		"https://evil.example/Air.svg":                                         false,
+		"//evil.example/Air.svg":                                               false,
+		"javascript:alert(1)":                                                  false,
+		"https://static.wikia.nocookie.net@evil.example/Air.svg":               false,
+		"https://static.wikia.nocookie.net.evil.example/Air.svg":               false,
+		"/api/images/Fire":                                                     false,
+	}
+	for src, redirect := range cases {
+		ds := &dataset{Name: "test", Elements: []Element{{Name: "Air", Base: true, ImgSrc: src}}}
+		registry := newDatasetRegistry("test")
+		registry.add(newDatasetStore(ds, ""))
+		handler := imageHandler(&imageStore{dir: t.TempDir()}, registry)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/images/Air", nil))
+		if redirect {
+			if rec.Code != http.StatusFound || rec.Header().Get("Location") != src {
+				t.Errorf("%s: status %d to %q, want a redirect", src, rec.Code, rec.Header().Get("Location"))
+			}
+		} else if rec.Code != http.StatusOK || rec.Header().Get("X-Image-Source") != "placeholder" {
+			t.Errorf("%s: status %d from %q, want the placeholder", src, rec.Code, rec.Header().Get("X-Image-Source"))
+		}
+	}
+}
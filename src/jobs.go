@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+var errQueueFull = errors.New("job queue is full")
+
+type searchJob struct {
+	ID         string
+	Options    SearchOptions
+	Dataset    *dataset
+	Status     string
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	steps  int64
+	tier   int64
+	result *ExportableElement
+	// Stops the search when the job is cancelled
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+type jobView struct {
+	ID         string        `json:"id"`
+	Options    SearchOptions `json:"options"`
+	Version    string        `json:"datasetVersion"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Steps      int64         `json:"steps"`
+	LastTier   int64         `json:"lastTier"`
+	ElapsedMs  int64         `json:"elapsedMs"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	StartedAt  *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+// Runs searches on a bounded pool of workers and keeps finished jobs
+// around for the retention period so clients can poll them.
+type jobManager struct {
+	mu        sync.Mutex
+	jobs      map[string]*searchJob
+	queue     chan *searchJob
+	retention time.Duration
+	registry  *datasetRegistry
+	cache     *resultCache
+}
+
+func newJobManager(registry *datasetRegistry, cache *resultCache, workers int, retention time.Duration) *jobManager {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &jobManager{
+		jobs:      make(map[string]*searchJob),
+		queue:     make(chan *searchJob, workers*16),
+		retention: retention,
+		registry:  registry,
+		cache:     cache,
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker(i)
+	}
+	go m.janitor()
+	return m
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (m *jobManager) submit(opts SearchOptions) (*searchJob, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	store, ok := m.registry.get(opts.Dataset)
+	if !ok {
+		return nil, fmt.Errorf("dataset %q not found", opts.Dataset)
+	}
+	ds := store.load()
+	opts.Dataset = ds.Name
+	job := &searchJob{
+		ID:        newJobID(),
+		Options:   opts,
+		Dataset:   ds,
+		Status:    jobQueued,
+		CreatedAt: time.Now(),
+	}
+	job.ctx, job.stop = context.WithCancel(context.Background())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case m.queue <- job:
+	default:
+		return nil, errQueueFull
+	}
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *jobManager) worker(id int) {
+	for job := range m.queue {
+		m.mu.Lock()
+		if job.Status == jobCancelled {
+			m.mu.Unlock()
+			continue
+		}
+		job.Status = jobRunning
+		job.StartedAt = time.Now()
+		m.mu.Unlock()
+		fmt.Printf("[Job worker %d] Running job %s\n", id, job.ID)
+
+		result, _, err := m.cache.search(job.ctx, job.Dataset, job.Options, func(tier int) {
+			atomic.AddInt64(&job.steps, 1)
+			atomic.StoreInt64(&job.tier, int64(tier))
+		})
+		job.stop()
+
+		m.mu.Lock()
+		job.FinishedAt = time.Now()
+		// A cancelled job stopped its search early, its result is dropped
+		if job.Status != jobCancelled {
+			if err != nil {
+				job.Status = jobFailed
+				job.Error = err.Error()
+			} else {
+				job.Status = jobDone
+				job.result = &result
+			}
+		}
+		m.mu.Unlock()
+		fmt.Printf("[Job worker %d] Job %s finished: %s\n", id, job.ID, job.Status)
+	}
+}
+
+func (m *jobManager) janitor() {
+	interval := max(m.retention/2, time.Second)
+	for range time.Tick(interval) {
+		m.sweep()
+	}
+}
+
+// Drops finished jobs once they are older than the retention period
+func (m *jobManager) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, job := range m.jobs {
+		if job.FinishedAt.IsZero() && job.Status != jobCancelled {
+			continue
+		}
+		finished := job.FinishedAt
+		if finished.IsZero() {
+			finished = job.CreatedAt
+		}
+		if time.Since(finished) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (m *jobManager) get(id string) (*searchJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+func (m *jobManager) cancel(id string) (*searchJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	if job.Status == jobQueued || job.Status == jobRunning {
+		job.Status = jobCancelled
+		job.result = nil
+		job.stop()
+	}
+	return job, true
+}
+
+func (m *jobManager) view(job *searchJob) jobView {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v := jobView{
+		ID:        job.ID,
+		Options:   job.Options,
+		Version:   job.Dataset.Version,
+		Status:    job.Status,
+		Error:     job.Error,
+		Steps:     atomic.LoadInt64(&job.steps),
+		LastTier:  atomic.LoadInt64(&job.tier),
+		CreatedAt: job.CreatedAt,
+	}
+	if !job.StartedAt.IsZero() {
+		started := job.StartedAt
+		v.StartedAt = &started
+		end := time.Now()
+		if !job.FinishedAt.IsZero() {
+			end = job.FinishedAt
+		}
+		v.ElapsedMs = end.Sub(started).Milliseconds()
+	}
+	if !job.FinishedAt.IsZero() {
+		finished := job.FinishedAt
+		v.FinishedAt = &finished
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("Error encoding JSON:", err)
+	}
+}
+
+// POST /jobs, GET /jobs/{id}, GET /jobs/{id}/result, DELETE /jobs/{id}.
+// DELETE stops the search of a running job and frees its worker.
+func (m *jobManager) handler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	parts := strings.Split(path, "/")
+
+	if path == "" {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST to create a job"})
+			return
+		}
+		var opts SearchOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid job body: " + err.Error()})
+			return
+		}
+		job, err := m.submit(opts)
+		if errors.Is(err, errQueueFull) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, m.view(job))
+		return
+	}
+
+	job, ok := m.get(parts[0])
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "job not found"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.view(job))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		m.cancel(job.ID)
+		writeJSON(w, http.StatusOK, m.view(job))
+	case len(parts) == 2 && parts[1] == "result" && r.Method == http.MethodGet:
+		v := m.view(job)
+		m.mu.Lock()
+		result := job.result
+		m.mu.Unlock()
+		if v.Status == jobFailed {
+			status := http.StatusInternalServerError
+			if v.Error == errElementNotFound.Error() {
+				status = http.StatusNotFound
+			}
+			writeJSON(w, status, map[string]string{"error": v.Error})
+			return
+		}
+		if result == nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "job is " + v.Status})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown job route"})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Job manager without running workers, the test drives the queue
+func testJobManager(tb testing.TB, retention time.Duration) *jobManager {
+	tb.Helper()
+	return &jobManager{
+		jobs:      make(map[string]*searchJob),
+		queue:     make(chan *searchJob, 4),
+		retention: retention,
+		registry:  testRegistry(tb),
+		cache:     newResultCache(16, ""),
+	}
+}
+
+// Runs every queued job on one worker until the queue is empty
+func drainJobs(m *jobManager) {
+	close(m.queue)
+	m.worker(0)
+}
+
+// A cancelled job keeps its status and no result once a worker reaches it,
+// and the janitor drops it after the retention period
+func TestJobCancel(t *testing.T) {
+	m := testJobManager(t, 10*time.Millisecond)
+	job, err := m.submit(SearchOptions{Algorithm: "BFS", Element: "T3E1", RecipeAmount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.cancel(job.ID); !ok {
+		t.Fatalf("job %s not found", job.ID)
+	}
+	if job.ctx.Err() == nil {
+		t.Error("cancelling did not stop the search context")
+	}
+	drainJobs(m)
+
+	v := m.view(job)
+	if v.Status != jobCancelled {
+		t.Errorf("status %q, want %q", v.Status, jobCancelled)
+	}
+	if job.result != nil {
+		t.Error("cancelled job kept a result")
+	}
+	if v.StartedAt != nil {
+		t.Error("a worker started a cancelled job")
+	}
+
+	m.sweep()
+	if _, ok := m.get(job.ID); !ok {
+		t.Fatal("job dropped before the retention period")
+	}
+	time.Sleep(2 * m.retention)
+	m.sweep()
+	if _, ok := m.get(job.ID); ok {
+		t.Error("job kept after the retention period")
+	}
+}
+
+// Cancelling a finished job changes nothing
+func TestJobCancelFinished(t *testing.T) {
+	m := testJobManager(t, time.Hour)
+	job, err := m.submit(SearchOptions{Algorithm: "BFS", Element: "T3E1", RecipeAmount: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainJobs(m)
+	m.cancel(job.ID)
+
+	if v := m.view(job); v.Status != jobDone {
+		t.Fatalf("status %q (%s), want %q", v.Status, v.Error, jobDone)
+	}
+	if job.result == nil || job.result.Name != "T3E1" {
+		t.Errorf("finished job lost its result: %+v", job.result)
+	}
+	m.sweep()
+	if _, ok := m.get(job.ID); !ok {
+		t.Error("job dropped before the retention period")
+	}
+}
+
+func TestJobCancelUnknown(t *testing.T) {
+	m := testJobManager(t, time.Hour)
+	if _, ok := m.cancel("missing"); ok {
+		t.Error("cancelled a job that does not exist")
+	}
+}
+
+// Status and result of a job through the /jobs routes, before and after a
+// worker ran it
+func TestJobEndpoints(t *testing.T) {
+	m := testJobManager(t, time.Hour)
+	call := func(method, target, body string) (int, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		m.handler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var v map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, target, err, rec.Body)
+		}
+		return rec.Code, v
+	}
+
+	code, created := call(http.MethodPost, "/jobs", `{"element":"T3E1","algorithm":"BFS","recipeAmount":2}`)
+	if code != http.StatusAccepted || created["status"] != jobQueued {
+		t.Fatalf("creating a job: status %d, %v", code, created)
+	}
+	id := created["id"].(string)
+	_, missing := call(http.MethodPost, "/jobs", `{"element":"Nope","algorithm":"BFS","recipeAmount":2}`)
+	if code, _ := call(http.MethodGet, "/jobs/"+id+"/result", ""); code != http.StatusConflict {
+		t.Errorf("result of a queued job: status %d, want %d", code, http.StatusConflict)
+	}
+	drainJobs(m)
+
+	if code, v := call(http.MethodGet, "/jobs/"+id, ""); code != http.StatusOK || v["status"] != jobDone {
+		t.Errorf("finished job: status %d, %v", code, v)
+	}
+	if code, v := call(http.MethodGet, "/jobs/"+id+"/result", ""); code != http.StatusOK || v["name"] != "T3E1" {
+		t.Errorf("result: status %d, %v", code, v)
+	}
+	if code, _ := call(http.MethodGet, "/jobs/"+missing["id"].(string)+"/result", ""); code != http.StatusNotFound {
+		t.Errorf("result of a job for an unknown element: status %d, want %d", code, http.StatusNotFound)
+	}
+
+	cases := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/jobs", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/jobs", "{", http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"element":"T3E1","algorithm":"Nope","recipeAmount":2}`, http.StatusBadRequest},
+		{http.MethodGet, "/jobs/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + id + "/other", "", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if code, _ := call(c.method, c.target, c.body); code != c.want {
+			t.Errorf("%s %s: status %d, want %d", c.method, c.target, code, c.want)
+		}
+	}
+}
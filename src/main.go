@@ -1,14 +1,90 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 )
 
+type datasetFlag map[string]string
+
+func (f datasetFlag) String() string {
+	parts := []string{}
+	for name, path := range f {
+		parts = append(parts, name+"="+path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f datasetFlag) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("expected name=path, got %q", value)
+	}
+	f[name] = path
+	return nil
+}
+
 func main() {
-	jsonBytes, err := convertToJson(scrape())
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	maxJobs := flag.Int("max-jobs", 2, "number of search jobs run concurrently")
+	jobRetention := flag.Duration("job-retention", 10*time.Minute, "how long finished jobs are kept")
+	cacheSize := flag.Int("cache-size", 256, "number of search results kept in memory, 0 disables the cache")
+	cacheFile := flag.String("cache-file", "", "file the result cache is persisted to")
+	batchLimit := flag.Int("batch-concurrency", 4, "maximum searches run at once for a batch request")
+	dataFile := flag.String("data", "", "load the dataset from this snapshot file instead of scraping")
+	watchInterval := flag.Duration("watch", 0, "poll the -data file and reload it when it changes, 0 disables")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for the /admin routes and dataset uploads")
+	defaultDataset := flag.String("default-dataset", "la2", "name of the dataset loaded with -data or scraped")
+	datasets := datasetFlag{}
+	flag.Var(datasets, "dataset", "extra dataset as name=snapshot.json or name=scrape:la1, can be repeated")
+	game := flag.String("game", "la2", "game scraped when -data is not set, la2 or la1")
+	computedTiers := flag.Bool("computed-tiers", false, "replace dataset tiers with the minimal crafting depth from the base elements")
+	base := flag.String("base", "", "comma separated starting elements of the default dataset, defaults to the tier 0 elements")
+	imageDir := flag.String("image-dir", "images", "directory of icons mirrored with the mirror-images command")
+	flag.Parse()
+
+	scraper, ok := scrapers[*game]
+	if !ok {
+		fmt.Println("Unknown game:", *game)
+		return
+	}
+	var jsonBytes []byte
+	var err error
+	if *dataFile != "" {
+		jsonBytes, err = os.ReadFile(*dataFile)
+	} else {
+		jsonBytes, err = convertToJson(scraper())
+	}
 	if err != nil {
-		fmt.Println("Error converting to JSON:", err)
+		fmt.Println("Error loading dataset:", err)
 		return
 	}
-	serve(jsonBytes)
+	serve(jsonBytes, serverConfig{
+		MaxJobs:        *maxJobs,
+		JobRetention:   *jobRetention,
+		CacheSize:      *cacheSize,
+		CacheFile:      *cacheFile,
+		BatchLimit:     *batchLimit,
+		DataFile:       *dataFile,
+		DefaultDataset: *defaultDataset,
+		Datasets:       datasets,
+		Game:           *game,
+		ComputedTiers:  *computedTiers,
+		Base:           splitList(*base),
+		ImageDir:       *imageDir,
+		WatchInterval:  *watchInterval,
+		AdminToken:     *adminToken,
+	})
 }
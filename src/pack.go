@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A user defined set of elements, uploaded as JSON, YAML or CSV
+type recipePack struct {
+	Name     string        `json:"name" yaml:"name"`
+	Base     []string      `json:"base" yaml:"base"`
+	AutoTier bool          `json:"autoTier" yaml:"autoTier"`
+	Elements []packElement `json:"elements" yaml:"elements"`
+}
+
+type packElement struct {
+	Name    string     `json:"name" yaml:"name"`
+	Tier    *int       `json:"tier,omitempty" yaml:"tier,omitempty"`
+	Recipes [][]string `json:"recipes" yaml:"recipes"`
+	ImgSrc  string     `json:"img_src,omitempty" yaml:"img_src,omitempty"`
+	Unlock  *Unlock    `json:"unlock,omitempty" yaml:"unlock,omitempty"`
+	// Optional costs, same meaning as in Element
+	Cost        *float64  `json:"cost,omitempty" yaml:"cost,omitempty"`
+	RecipeCosts []float64 `json:"recipe_costs,omitempty" yaml:"recipe_costs,omitempty"`
+}
+
+// All problems found in a pack, reported together
+type packErrors []string
+
+func (e packErrors) Error() string {
+	return fmt.Sprintf("invalid recipe pack: %s", strings.Join(e, "; "))
+}
+
+func packFormat(name string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")) {
+	case "yaml", "yml":
+		return "yaml"
+	case "csv":
+		return "csv"
+	}
+	return "json"
+}
+
+func contentFormat(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "yaml"):
+		return "yaml"
+	case strings.Contains(contentType, "csv"):
+		return "csv"
+	}
+	return "json"
+}
+
+func parsePack(data []byte, format string) (*recipePack, error) {
+	var pack recipePack
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("invalid JSON pack: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &pack); err != nil {
+			return nil, fmt.Errorf("invalid YAML pack: %w", err)
+		}
+	case "csv":
+		return parseCSVPack(data)
+	default:
+		return nil, fmt.Errorf("unknown pack format %q", format)
+	}
+	return &pack, nil
+}
+
+// CSV packs have one recipe per row under an element header. Ingredients
+// are an ingredients column split on "+", or ingredient1, ingredient2, ...
+// columns for any number of them. Optional columns: tier, img_src, cost
+// (of the element), recipe_cost (of the row's recipe) and unlock (the
+// number of discoveries). A row without ingredients only declares the
+// element, and tier 0 rows are the base.
+func parseCSVPack(data []byte) (*recipePack, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV pack: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("invalid CSV pack: no header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["element"]; !ok {
+		return nil, fmt.Errorf("invalid CSV pack: missing %q column", "element")
+	}
+	// Numbered ingredient columns in order, ingredient1 first
+	var ingredientColumns []string
+	for n := 1; ; n++ {
+		name := "ingredient" + strconv.Itoa(n)
+		if _, ok := columns[name]; !ok {
+			break
+		}
+		ingredientColumns = append(ingredientColumns, name)
+	}
+	_, hasList := columns["ingredients"]
+	if !hasList && len(ingredientColumns) == 0 {
+		return nil, fmt.Errorf("invalid CSV pack: missing %q or %q column", "ingredients", "ingredient1")
+	}
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	pack := &recipePack{}
+	index := make(map[string]int)
+	// Cost of every recipe of an element, nil where the row has none
+	recipeCosts := make(map[string][]*float64)
+	var errs packErrors
+	number := func(line int, column, value string) (float64, bool) {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %s %q is not a number", line, column, value))
+			return 0, false
+		}
+		return n, true
+	}
+	for line, row := range rows[1:] {
+		line += 2
+		name := field(row, "element")
+		if name == "" {
+			errs = append(errs, fmt.Sprintf("line %d: element is empty", line))
+			continue
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(pack.Elements)
+			index[name] = i
+			pack.Elements = append(pack.Elements, packElement{Name: name})
+		}
+		el := &pack.Elements[i]
+		if t := field(row, "tier"); t != "" {
+			tier, err := strconv.Atoi(t)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("line %d: tier %q is not a number", line, t))
+			} else {
+				el.Tier = &tier
+				if tier == 0 && !contains(pack.Base, name) {
+					pack.Base = append(pack.Base, name)
+				}
+			}
+		}
+		if img := field(row, "img_src"); img != "" {
+			el.ImgSrc = img
+		}
+		if c := field(row, "cost"); c != "" {
+			if cost, ok := number(line, "cost", c); ok {
+				el.Cost = &cost
+			}
+		}
+		if u := field(row, "unlock"); u != "" {
+			discoveries, err := strconv.Atoi(u)
+			if err != nil || discoveries < 0 {
+				errs = append(errs, fmt.Sprintf("line %d: unlock %q is not a number of discoveries", line, u))
+			} else {
+				el.Unlock = &Unlock{Discoveries: discoveries}
+			}
+		}
+
+		var ingredients []string
+		if list := field(row, "ingredients"); list != "" {
+			for _, ing := range strings.Split(list, "+") {
+				ingredients = append(ingredients, strings.TrimSpace(ing))
+			}
+		}
+		for _, column := range ingredientColumns {
+			if ing := field(row, column); ing != "" {
+				ingredients = append(ingredients, ing)
+			}
+		}
+		if len(ingredients) == 0 {
+			if field(row, "recipe_cost") != "" {
+				errs = append(errs, fmt.Sprintf("line %d: recipe_cost without ingredients", line))
+			}
+			continue
+		}
+		el.Recipes = append(el.Recipes, ingredients)
+		var recipeCost *float64
+		if c := field(row, "recipe_cost"); c != "" {
+			if cost, ok := number(line, "recipe_cost", c); ok {
+				recipeCost = &cost
+			}
+		}
+		recipeCosts[name] = append(recipeCosts[name], recipeCost)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Recipes without a cost of their own cost what the element does
+	for i := range pack.Elements {
+		el := &pack.Elements[i]
+		costs := recipeCosts[el.Name]
+		if !slices.ContainsFunc(costs, func(c *float64) bool { return c != nil }) {
+			continue
+		}
+		for _, c := range costs {
+			if c == nil {
+				c = el.Cost
+			}
+			if c == nil {
+				el.RecipeCosts = append(el.RecipeCosts, defaultRecipeCost)
+			} else {
+				el.RecipeCosts = append(el.RecipeCosts, *c)
+			}
+		}
+	}
+	return pack, nil
+}
+
+func contains(list []string, name string) bool {
+	for _, s := range list {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the pack and converts it to the dataset format. Every problem is
+// collected so the author can fix them in one go.
+func (pack *recipePack) toElements() ([]Element, error) {
+	var errs packErrors
+	if len(pack.Elements) == 0 {
+		return nil, packErrors{"pack has no elements"}
+	}
+
+	defined := make(map[string]bool)
+	for i, el := range pack.Elements {
+		switch {
+		case el.Name == "":
+			errs = append(errs, fmt.Sprintf("element #%d has no name", i+1))
+		case defined[el.Name]:
+			errs = append(errs, fmt.Sprintf("element %q is defined twice", el.Name))
+		}
+		defined[el.Name] = true
+	}
+
+	if len(pack.Base) == 0 {
+		errs = append(errs, "pack has no base elements")
+	}
+	isBase := make(map[string]bool)
+	for _, name := range pack.Base {
+		if !defined[name] {
+			errs = append(errs, fmt.Sprintf("base element %q is not defined", name))
+		}
+		isBase[name] = true
+	}
+
+	for _, el := range pack.Elements {
+		if isBase[el.Name] && len(el.Recipes) > 0 {
+			errs = append(errs, fmt.Sprintf("base element %q must not have recipes", el.Name))
+		}
+		if !isBase[el.Name] && len(el.Recipes) == 0 {
+			errs = append(errs, fmt.Sprintf("element %q has no recipes and is not a base element", el.Name))
+		}
+		for i, r := range el.Recipes {
+			if len(r) == 0 {
+				errs = append(errs, fmt.Sprintf("recipe #%d of %q has no ingredients", i+1, el.Name))
+				continue
+			}
+			for _, ing := range r {
+				if !defined[ing] {
+					errs = append(errs, fmt.Sprintf("recipe #%d of %q uses unknown ingredient %q", i+1, el.Name, ing))
+				}
+			}
+		}
+		if pack.AutoTier || el.Tier == nil {
+			continue
+		}
+		switch {
+		case *el.Tier < 0:
+			errs = append(errs, fmt.Sprintf("element %q has negative tier %d", el.Name, *el.Tier))
+		case isBase[el.Name] && *el.Tier != 0:
+			errs = append(errs, fmt.Sprintf("base element %q must be tier 0, got %d", el.Name, *el.Tier))
+		case !isBase[el.Name] && *el.Tier == 0:
+			errs = append(errs, fmt.Sprintf("element %q is tier 0 but not a base element", el.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	elements := make([]Element, 0, len(pack.Elements))
+	for _, el := range pack.Elements {
+		elmt := Element{Name: el.Name, ImgSrc: el.ImgSrc, Base: isBase[el.Name], Unlock: el.Unlock, Cost: el.Cost, RecipeCosts: el.RecipeCosts}
+		elmt.Recipes = append(elmt.Recipes, el.Recipes...)
+		elements = append(elements, elmt)
+	}
+
+	if pack.AutoTier {
+		tiers := computeTiers(elements, pack.Base)
+		for i := range elements {
+			tier, ok := tiers[elements[i].Name]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("element %q cannot be crafted from the base elements", elements[i].Name))
+			}
+			elements[i].Tier = tier
+		}
+	} else {
+		for i, el := range pack.Elements {
+			if el.Tier == nil {
+				errs = append(errs, fmt.Sprintf("element %q has no tier, set one or enable autoTier", el.Name))
+				continue
+			}
+			elements[i].Tier = *el.Tier
+		}
+		// Searches only follow recipes whose ingredients have lower tiers
+		tierOf := make(map[string]int)
+		for _, el := range elements {
+			tierOf[el.Name] = el.Tier
+		}
+		for _, el := range elements {
+			if el.Tier == 0 {
+				continue
+			}
+			usable := false
+			for _, r := range el.Recipes {
+				lower := true
+				for _, ing := range r {
+					lower = lower && tierOf[ing] < el.Tier
+				}
+				if lower {
+					usable = true
+					break
+				}
+			}
+			if !usable {
+				errs = append(errs, fmt.Sprintf("element %q (tier %d) has no recipe with lower tier ingredients", el.Name, el.Tier))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return elements, nil
+}
+
+// Parses, validates and converts a pack into dataset JSON
+func importPack(data []byte, format string, autoTier bool, base []string) ([]byte, *recipePack, error) {
+	pack, err := parsePack(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	pack.AutoTier = pack.AutoTier || autoTier
+	if len(base) > 0 {
+		pack.Base = base
+	}
+	elements, err := pack.toElements()
+	if err != nil {
+		return nil, pack, err
+	}
+	jsonBytes, err := convertToJson(elements)
+	return jsonBytes, pack, err
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// PUT or POST /datasets/{name} uploads a pack, DELETE removes an uploaded
+// pack. ?format=, ?autoTier=true and ?base=A,B override the pack itself.
+func (reg *datasetRegistry) packHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/datasets/"), "/")
+	if name == "" {
+		reg.listHandler(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+	case http.MethodDelete:
+		reg.mu.Lock()
+		store, ok := reg.stores[name]
+		if ok && store.uploaded {
+			delete(reg.stores, name)
+		}
+		reg.mu.Unlock()
+		if !ok || !store.uploaded {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no uploaded dataset %q", name)})
+			return
+		}
+		for _, fn := range reg.onRemove {
+			fn(store.load())
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": name})
+		return
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use PUT, POST or DELETE"})
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = contentFormat(r.Header.Get("Content-Type"))
+	}
+	jsonBytes, _, err := importPack(data, format, r.URL.Query().Get("autoTier") == "true", splitList(r.URL.Query().Get("base")))
+	if errs, ok := err.(packErrors); ok {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": errs})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{err.Error()}})
+		return
+	}
+
+	status := http.StatusOK
+	var ds *dataset
+	store, exists := reg.get(name)
+	if !exists {
+		ds, err = parseDataset(name, jsonBytes, nil)
+		if err == nil {
+			uploaded := newDatasetStore(ds, "")
+			uploaded.uploaded = true
+			// Another upload of the same name may have won, which this
+			// one then updates
+			var added bool
+			store, added = reg.putIfAbsent(uploaded)
+			exists = !added
+			if added {
+				status = http.StatusCreated
+			}
+		}
+	}
+	if exists && !store.uploaded {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("dataset %q is not an uploaded pack", name)})
+		return
+	}
+	if exists {
+		ds, err = store.reload(jsonBytes)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": []string{err.Error()}})
+		return
+	}
+	fmt.Printf("Recipe pack %s imported with %d elements\n", ds.Name, len(ds.Elements))
+	w.Header().Set("X-Dataset-Version", ds.Version)
+	writeJSON(w, status, datasetInfo{
+		Name:     ds.Name,
+		Version:  ds.Version,
+		Elements: len(ds.Elements),
+		LoadedAt: ds.LoadedAt,
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseCSVPack(t *testing.T) {
+	data := []byte(`element,ingredients,tier,cost,recipe_cost,unlock
+Air,,0,0.5,,
+Fire,,0,,,
+Water,,0,,,
+Steam,Fire+Water,1,2,,3
+Steam,Air + Fire + Water,,,0.25,
+Cloud,Steam,2,,,
+`)
+	pack, err := parseCSVPack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Air", "Fire", "Water"}; !reflect.DeepEqual(pack.Base, want) {
+		t.Errorf("base %v, want %v", pack.Base, want)
+	}
+	elements := make(map[string]packElement)
+	for _, el := range pack.Elements {
+		elements[el.Name] = el
+	}
+	steam := elements["Steam"]
+	if want := [][]string{{"Fire", "Water"}, {"Air", "Fire", "Water"}}; !reflect.DeepEqual(steam.Recipes, want) {
+		t.Errorf("Steam recipes %v, want %v", steam.Recipes, want)
+	}
+	if steam.Cost == nil || *steam.Cost != 2 {
+		t.Errorf("Steam cost %v, want 2", steam.Cost)
+	}
+	// The recipe without its own cost costs what the element does
+	if want := []float64{2, 0.25}; !reflect.DeepEqual(steam.RecipeCosts, want) {
+		t.Errorf("Steam recipe costs %v, want %v", steam.RecipeCosts, want)
+	}
+	if steam.Unlock == nil || steam.Unlock.Discoveries != 3 {
+		t.Errorf("Steam unlock %v, want 3 discoveries", steam.Unlock)
+	}
+	if air := elements["Air"]; air.Cost == nil || *air.Cost != 0.5 {
+		t.Errorf("Air cost %v, want 0.5", air.Cost)
+	}
+	if cloud := elements["Cloud"]; !reflect.DeepEqual(cloud.Recipes, [][]string{{"Steam"}}) || cloud.RecipeCosts != nil {
+		t.Errorf("Cloud recipes %v with costs %v, want [[Steam]] without costs", cloud.Recipes, cloud.RecipeCosts)
+	}
+	if _, _, err := importPack(data, "csv", false, nil); err != nil {
+		t.Errorf("import: %v", err)
+	}
+}
+
+// Numbered ingredient columns still work and take any number of ingredients
+func TestParseCSVPackIngredientColumns(t *testing.T) {
+	data := []byte(`element,ingredient1,ingredient2,ingredient3
+Air,,,
+Fire,,,
+Energy,Fire,Fire,
+Heat,Air,Fire,Energy
+`)
+	pack, err := parseCSVPack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"Air", "Fire", "Energy"}}
+	if got := pack.Elements[3].Recipes; !reflect.DeepEqual(got, want) {
+		t.Errorf("Heat recipes %v, want %v", got, want)
+	}
+}
+
+func TestParseCSVPackErrors(t *testing.T) {
+	cases := map[string]string{
+		"no ingredient column": "element,tier\nAir,0\n",
+		"bad cost":             "element,ingredients,cost\nSteam,Fire+Water,cheap\n",
+		"bad recipe cost":      "element,ingredients,recipe_cost\nSteam,Fire+Water,-\n",
+		"bad unlock":           "element,ingredients,unlock\nSteam,Fire+Water,-1\n",
+		"orphan recipe cost":   "element,ingredients,recipe_cost\nSteam,,2\n",
+	}
+	for name, data := range cases {
+		if _, err := parseCSVPack([]byte(data)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// Deleting an uploaded pack drops its cached results and keeps the others
+func TestDeletePackPurgesCache(t *testing.T) {
+	registry := testRegistry(t)
+	cache := newResultCache(8, "")
+	registry.onRemove = append(registry.onRemove, func(ds *dataset) { cache.purgeVersion(ds.Version) })
+	pack := "element,ingredients,tier\nAir,,0\nFire,,0\nWater,,0\nSteam,Fire+Water,1\nCloud,Air+Steam,2\n"
+	rec := httptest.NewRecorder()
+	registry.packHandler(rec, httptest.NewRequest(http.MethodPut, "/datasets/pack?format=csv", strings.NewReader(pack)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx := quietContext(false)
+	for name, element := range map[string]string{"pack": "Cloud", "test": "T3E1"} {
+		store, _ := registry.get(name)
+		opts := SearchOptions{Dataset: name, Element: element, Algorithm: "BFS", RecipeAmount: 1}
+		if _, _, err := cache.search(ctx, store.load(), opts, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	registry.packHandler(rec, httptest.NewRequest(http.MethodDelete, "/datasets/pack", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if size := cache.snapshotStats().Size; size != 1 {
+		t.Errorf("%d cached results after deleting the pack, want the one of test", size)
+	}
+}
+
+// The same pack written as JSON, YAML and CSV gives the same dataset
+func TestPackFormats(t *testing.T) {
+	packs := map[string]string{
+		"json": `{"name":"kitchen","base":["Air","Fire","Water"],"elements":[
+			{"name":"Air","tier":0},{"name":"Fire","tier":0},{"name":"Water","tier":0},
+			{"name":"Steam","tier":1,"recipes":[["Fire","Water"],["Air","Fire","Water"]]},
+			{"name":"Cloud","tier":2,"recipes":[["Steam"]]}]}`,
+		"yaml": `name: kitchen
+base: [Air, Fire, Water]
+elements:
+  - {name: Air, tier: 0}
+  - {name: Fire, tier: 0}
+  - {name: Water, tier: 0}
+  - name: Steam
+    tier: 1
+    recipes: [[Fire, Water], [Air, Fire, Water]]
+  - name: Cloud
+    tier: 2
+    recipes: [[Steam]]
+`,
+		"csv": `element,ingredients,tier
+Air,,0
+Fire,,0
+Water,,0
+Steam,Fire+Water,1
+Steam,Air+Fire+Water,1
+Cloud,Steam,2
+`,
+	}
+	var want []byte
+	for _, format := range []string{"json", "yaml", "csv"} {
+		jsonBytes, _, err := importPack([]byte(packs[format]), format, false, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if want == nil {
+			want = jsonBytes
+		} else if string(jsonBytes) != string(want) {
+			t.Errorf("%s gives\n%s\nJSON gives\n%s", format, jsonBytes, want)
+		}
+	}
+
+	for name, format := range map[string]string{"pack.yml": "yaml", "pack.YAML": "yaml", "pack.csv": "csv", "pack.json": "json", "pack": "json"} {
+		if got := packFormat(name); got != format {
+			t.Errorf("packFormat(%q) = %s, want %s", name, got, format)
+		}
+	}
+	for contentType, format := range map[string]string{"application/yaml": "yaml", "text/csv; charset=utf-8": "csv", "application/json": "json", "": "json"} {
+		if got := contentFormat(contentType); got != format {
+			t.Errorf("contentFormat(%q) = %s, want %s", contentType, got, format)
+		}
+	}
+	if _, err := parsePack([]byte(packs["json"]), "toml"); err == nil {
+		t.Error("no error for an unknown format")
+	}
+}
+
+// Uploads pick the format from ?format= or the content type
+func TestUploadPackFormats(t *testing.T) {
+	mux := testMux(t, serverConfig{})
+	csvPack := "element,ingredients,tier\nAir,,0\nFire,,0\nSmoke,Air+Fire,1\n"
+	yamlPack := "base: [Air, Fire]\nautoTier: true\nelements:\n  - {name: Air}\n  - {name: Fire}\n  - {name: Smoke, recipes: [[Air, Fire]]}\n"
+	cases := []struct {
+		target, contentType, body string
+		want                      int
+	}{
+		{"/datasets/csv?format=csv", "", csvPack, http.StatusCreated},
+		{"/datasets/yaml", "application/yaml", yamlPack, http.StatusCreated},
+		{"/datasets/yaml", "application/yaml", yamlPack, http.StatusOK},
+		{"/datasets/wrong", "application/json", csvPack, http.StatusBadRequest},
+		{"/datasets/test", "text/csv", csvPack, http.StatusConflict},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPut, c.target, strings.NewReader(c.body))
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("PUT %s as %q: status %d, want %d: %s", c.target, c.contentType, rec.Code, c.want, rec.Body)
+		}
+	}
+	for _, name := range []string{"csv", "yaml"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/BFS/Smoke?recipeAmount=1&dataset="+name, nil).WithContext(quietContext(false)))
+		if rec.Code != http.StatusOK {
+			t.Errorf("searching the %s pack: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+// Every problem of a pack is reported at once
+func TestPackValidation(t *testing.T) {
+	pack := `{"base":["Air","Ghost"],"elements":[
+		{"name":"Air","tier":0,"recipes":[["Air"]]},
+		{"name":"Air","tier":0},
+		{"name":"Smoke","tier":1,"recipes":[["Air","Fire"]]},
+		{"name":"Dust","tier":0,"recipes":[["Air"]]},
+		{"name":"Mud"}]}`
+	_, _, err := importPack([]byte(pack), "json", false, nil)
+	errs, ok := err.(packErrors)
+	if !ok {
+		t.Fatalf("error %v, want the pack errors", err)
+	}
+	for _, want := range []string{
+		`element "Air" is defined twice`,
+		`base element "Ghost" is not defined`,
+		`base element "Air" must not have recipes`,
+		`unknown ingredient "Fire"`,
+		`element "Dust" is tier 0 but not a base element`,
+		`element "Mud" has no recipes and is not a base element`,
+	} {
+		if !strings.Contains(errs.Error(), want) {
+			t.Errorf("%q not reported in %v", want, errs)
+		}
+	}
+}
+
+// Uploads of the same new pack racing each other create it once, the
+// others update it
+func TestConcurrentPackUploads(t *testing.T) {
+	registry := testRegistry(t)
+	pack := "element,ingredients,tier\nAir,,0\nFire,,0\nWater,,0\nSteam,Fire+Water,1\nCloud,Air+Steam,2\n"
+	codes := make([]int, 16)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			rec := httptest.NewRecorder()
+			registry.packHandler(rec, httptest.NewRequest(http.MethodPut, "/datasets/pack?format=csv", strings.NewReader(pack)))
+			codes[i] = rec.Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK:
+		default:
+			t.Errorf("upload: status %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("pack created %d times, want once", created)
+	}
+	if stores := registry.all(); len(stores) != 2 {
+		t.Errorf("%d datasets, want test and pack", len(stores))
+	}
+
+	store, _ := registry.get("pack")
+	other := newDatasetStore(store.load(), "")
+	if got, added := registry.putIfAbsent(other); added || got != store {
+		t.Error("putIfAbsent replaced the registered pack")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Parses flags placed before or after the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Registers -data, -game and -base and returns the loader using them
+func datasetFlags(fs *flag.FlagSet) func() (*dataset, error) {
+	dataFile := fs.String("data", "", "dataset snapshot file (default: scrape -game)")
+	game := fs.String("game", "la2", "game scraped when -data is not set, la2 or la1")
+	base := fs.String("base", "", "comma separated starting elements, overrides the snapshot")
+	return func() (*dataset, error) {
+		return loadDataset(*dataFile, *game, splitList(*base))
+	}
+}
+
+// The algorithms log to stdout, searches run with this context keep that
+// out of the command output: logs go to stderr when verbose, nowhere
+// otherwise
+func quietContext(verbose bool) context.Context {
+	if verbose {
+		return withSearchLog(context.Background(), os.Stderr)
+	}
+	return withSearchLog(context.Background(), io.Discard)
+}
+
+func writeJSONTo(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// bfs, dfs, iddfs, astar and bidirectional run one search and print the tree
+func searchCommand(algorithm string) func(args []string) error {
+	return func(args []string) error {
+		fs := flag.NewFlagSet(strings.ToLower(algorithm), flag.ContinueOnError)
+		load := datasetFlags(fs)
+		amount := fs.Int("n", 1, "number of recipes to find")
+		left := fs.String("left", "DFS", "left side of a bidirectional search, BFS or DFS")
+		right := fs.String("right", "BFS", "right side of a bidirectional search, BFS or DFS")
+		heuristic := fs.String("heuristic", defaultHeuristic, "heuristic of astar: "+strings.Join(heuristicNames(), ", "))
+		weight := fs.Float64("weight", 1, "weight of the astar heuristic, above 1 trades optimality for speed")
+		costList := fs.String("cost", "", "element costs replacing the dataset's, e.g. Fire:2,Steam:0.5")
+		owned := fs.String("owned", "", "comma separated elements already owned, used as free leaves")
+		diverse := fs.Bool("diverse", false, "return the most different trees instead of the first ones")
+		format := fs.String("format", "text", "output format: text, json, dot or steps")
+		verbose := fs.Bool("v", false, "show the algorithm log on stderr")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s [flags] ELEMENT\n", fs.Name())
+			fs.PrintDefaults()
+		}
+		positional, err := parseArgs(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			fs.Usage()
+			return fmt.Errorf("expected one element name")
+		}
+		ds, err := load()
+		if err != nil {
+			return err
+		}
+		costs, err := parseCosts(*costList)
+		if err != nil {
+			return err
+		}
+
+		opts := SearchOptions{
+			Element:      positional[0],
+			Algorithm:    algorithm,
+			RecipeAmount: *amount,
+			Left:         *left,
+			Right:        *right,
+			Heuristic:    *heuristic,
+			Weight:       *weight,
+			Costs:        costs,
+			Owned:        splitList(*owned),
+			Diverse:      *diverse,
+		}
+		tree, err := runSearch(quietContext(*verbose), ds.Elements, opts, nil)
+		if err != nil {
+			return err
+		}
+		return writeTree(os.Stdout, tree, *format)
+	}
+}
+
+func writeTree(w io.Writer, tree ExportableElement, format string) error {
+	switch format {
+	case "text":
+		writeTreeText(w, tree, 0)
+	case "json":
+		return writeJSONTo(w, tree)
+	case "dot":
+		writeTreeDot(w, tree)
+	case "steps":
+		writeTreeSteps(w, tree)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return nil
+}
+
+// Element names indented by depth, each recipe shown as "= A + B"
+func writeTreeText(w io.Writer, el ExportableElement, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s%s\n", indent, el.Name)
+	for _, recipe := range el.Children {
+		names := make([]string, len(recipe.Children))
+		for i, ing := range recipe.Children {
+			names[i] = ing.Name
+		}
+		fmt.Fprintf(w, "%s  = %s\n", indent, strings.Join(names, " + "))
+		for _, ing := range recipe.Children {
+			if len(ing.Children) > 0 {
+				writeTreeText(w, ing, depth+2)
+			}
+		}
+	}
+}
+
+// Graphviz digraph with a box per element and a dot per recipe
+func writeTreeDot(w io.Writer, tree ExportableElement) {
+	fmt.Fprintln(w, "digraph recipes {")
+	fmt.Fprintln(w, "  node [shape=box];")
+	seen := make(map[string]bool)
+	recipes := 0
+	var walk func(el ExportableElement)
+	walk = func(el ExportableElement) {
+		if !seen[el.Name] {
+			seen[el.Name] = true
+			fmt.Fprintf(w, "  %q;\n", el.Name)
+		}
+		for _, recipe := range el.Children {
+			recipes++
+			id := fmt.Sprintf("r%d", recipes)
+			fmt.Fprintf(w, "  %s [shape=point];\n", id)
+			for _, ing := range recipe.Children {
+				walk(ing)
+				fmt.Fprintf(w, "  %q -> %s;\n", ing.Name, id)
+			}
+			fmt.Fprintf(w, "  %s -> %q;\n", id, el.Name)
+		}
+	}
+	walk(tree)
+	fmt.Fprintln(w, "}")
+}
+
+// Crafting steps in the order they can be done, ingredients first
+func writeTreeSteps(w io.Writer, tree ExportableElement) {
+	done := make(map[string]bool)
+	step := 0
+	var walk func(el ExportableElement)
+	walk = func(el ExportableElement) {
+		for _, recipe := range el.Children {
+			names := make([]string, len(recipe.Children))
+			for i, ing := range recipe.Children {
+				walk(ing)
+				names[i] = ing.Name
+			}
+			line := strings.Join(names, " + ") + " -> " + el.Name
+			if done[line] {
+				continue
+			}
+			done[line] = true
+			step++
+			fmt.Fprintf(w, "%d. %s\n", step, line)
+		}
+	}
+	walk(tree)
+	if step == 0 {
+		fmt.Fprintf(w, "%s is a base element\n", tree.Name)
+	}
+}
+
+// count prints the number of distinct crafting trees of each element
+func countCommand(args []string) error {
+	fs := flag.NewFlagSet("count", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("expected at least one element name")
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	elementMap, _ := buildGraph(ds.Elements)
+	counter := newTreeCounter(elementMap)
+	counts := make(map[string]string)
+	for _, name := range positional {
+		n := counter.countName(name)
+		if n == nil {
+			return fmt.Errorf("element %q not found", name)
+		}
+		counts[name] = n.String()
+		if *format == "text" {
+			fmt.Printf("%s: %s\n", name, n)
+		}
+	}
+	if *format == "json" {
+		return writeJSONTo(os.Stdout, counts)
+	}
+	return nil
+}
+
+type elementUse struct {
+	Result      string   `json:"result"`
+	Tier        int      `json:"tier"`
+	Ingredients []string `json:"ingredients"`
+}
+
+// Recipes of the dataset that take name as an ingredient
+func findUses(elements []Element, name string) []elementUse {
+	uses := []elementUse{}
+	for _, el := range elements {
+		for _, r := range el.Recipes {
+			if contains(r, name) {
+				uses = append(uses, elementUse{Result: el.Name, Tier: el.Tier, Ingredients: r})
+			}
+		}
+	}
+	sort.SliceStable(uses, func(i, j int) bool {
+		if uses[i].Tier != uses[j].Tier {
+			return uses[i].Tier < uses[j].Tier
+		}
+		return uses[i].Result < uses[j].Result
+	})
+	return uses
+}
+
+// uses lists the recipes an element is an ingredient of
+func usesCommand(args []string) error {
+	fs := flag.NewFlagSet("uses", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("expected one element name")
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+	found := false
+	for _, el := range ds.Elements {
+		found = found || el.Name == name
+	}
+	if !found {
+		return fmt.Errorf("element %q not found", name)
+	}
+	uses := findUses(ds.Elements, name)
+	if *format == "json" {
+		return writeJSONTo(os.Stdout, uses)
+	}
+	for _, use := range uses {
+		fmt.Printf("%s -> %s (tier %d)\n", strings.Join(use.Ingredients, " + "), use.Result, use.Tier)
+	}
+	fmt.Fprintf(os.Stderr, "%s is used in %d recipes\n", name, len(uses))
+	return nil
+}
+
+// export writes the whole dataset as a snapshot or as a DOT graph
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	format := fs.String("format", "json", "output format: json or dot")
+	out := fs.String("o", "", "write to this file instead of stdout")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		jsonBytes, err := convertToJson(ds.Elements)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(jsonBytes)
+		return err
+	case "dot":
+		fmt.Fprintln(w, "digraph recipes {")
+		for _, el := range ds.Elements {
+			fmt.Fprintf(w, "  %q [label=%q];\n", el.Name, fmt.Sprintf("%s (%d)", el.Name, el.Tier))
+		}
+		for _, el := range ds.Elements {
+			for _, r := range el.Recipes {
+				for _, ing := range r {
+					fmt.Fprintf(w, "  %q -> %q;\n", ing, el.Name)
+				}
+			}
+		}
+		fmt.Fprintln(w, "}")
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", *format)
+}
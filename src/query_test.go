@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs a command with its standard output captured
+func captureStdout(tb testing.TB, run func() error) (string, error) {
+	tb.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+	err = run()
+	w.Close()
+	return string(<-out), err
+}
+
+// JSON output can be piped into other tools, warnings about the dataset
+// and search logs go to stderr
+func TestCommandsPrintOnlyJSON(t *testing.T) {
+	elements := testElements(t, generatorOptions{Elements: 30, Base: 4, Tiers: 5, Recipes: 2, MinIngredients: 2, MaxIngredients: 3, Dangling: 2, Seed: 1})
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "elements.json")
+	if err := os.WriteFile(file, jsonBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runs := [][]string{
+		{"dfs", "-data", file, "-format", "json", "-n", "3", "T4E1"},
+		{"bfs", "-data", file, "-format", "json", "-n", "3", "T4E1"},
+		{"bidirectional", "-data", file, "-format", "json", "T4E1"},
+		{"astar", "-data", file, "-format", "json", "T4E1"},
+		{"count", "-data", file, "-format", "json", "T4E1", "T5E1"},
+		{"export", "-data", file},
+	}
+	for _, args := range runs {
+		out, err := captureStdout(t, func() error { return commands[args[0]](args[1:]) })
+		if err != nil {
+			t.Errorf("%s: %v", strings.Join(args, " "), err)
+			continue
+		}
+		var v any
+		if err := json.Unmarshal([]byte(out), &v); err != nil {
+			t.Errorf("%s: stdout is not JSON: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
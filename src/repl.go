@@ -0,0 +1,508 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// Interactive shell over one loaded dataset
+type repl struct {
+	ds         *dataset
+	elementMap map[string]*ElementNode
+	names      []string
+	counter    *treeCounter
+	out        io.Writer
+
+	// Defaults for search and compare, changed with set
+	defaults SearchOptions
+
+	// Last search result and the path walked into it
+	tree *ExportableElement
+	path []*ExportableElement
+}
+
+type replAction struct {
+	usage string
+	help  string
+	// Words before the element name, used for completion
+	prefix int
+	run    func(r *repl, args []string) error
+}
+
+var replCommands map[string]replAction
+
+func init() {
+	replCommands = map[string]replAction{
+		"help":    {"help", "list the commands", 0, (*repl).help},
+		"info":    {"info ELEMENT", "tier, recipes, uses and number of trees", 1, (*repl).info},
+		"recipes": {"recipes ELEMENT", "recipes that craft the element", 1, (*repl).recipes},
+		"uses":    {"uses ELEMENT", "recipes the element is an ingredient of", 1, (*repl).uses},
+		"search":  {"search " + strings.Join(algorithms, "|") + " ELEMENT [options]", "run a search and show the tree", 2, (*repl).search},
+		"compare": {"compare ELEMENT [n=]", "run every algorithm on the element", 1, (*repl).compare},
+		"tree":    {"tree", "show the current (sub)tree", 0, (*repl).showTree},
+		"into":    {"into ELEMENT", "walk into a sub-tree of the current tree", 1, (*repl).into},
+		"up":      {"up", "go back to the parent tree", 0, (*repl).up},
+		"count":   {"count ELEMENT", "number of distinct crafting trees", 1, (*repl).count},
+		"set":     {"set [n=] [left=] [right=] [heuristic=] [weight=]", "change the search defaults", 0, (*repl).set},
+		"stats":   {"stats", "dataset statistics", 0, (*repl).stats},
+	}
+}
+
+func newRepl(ds *dataset, out io.Writer) *repl {
+	elementMap, _ := buildGraph(ds.Elements)
+	names := make([]string, 0, len(elementMap))
+	for name := range elementMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &repl{
+		ds:         ds,
+		elementMap: elementMap,
+		names:      names,
+		counter:    newTreeCounter(elementMap),
+		out:        out,
+		defaults:   SearchOptions{RecipeAmount: 1, Left: "DFS", Right: "BFS"},
+	}
+}
+
+// Completes command names, then element names for the argument. Element
+// names may contain spaces, so everything after the prefix words counts.
+func (r *repl) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+	fields := strings.SplitN(text, " ", 2)
+	var candidates []string
+	var typed string
+	if len(fields) == 1 {
+		typed = fields[0]
+		for name := range replCommands {
+			candidates = append(candidates, name+" ")
+		}
+		candidates = append(candidates, "quit")
+	} else {
+		cmd, ok := replCommands[fields[0]]
+		if !ok || cmd.prefix == 0 {
+			return nil, 0
+		}
+		rest := fields[1]
+		if cmd.prefix == 2 {
+			words := strings.SplitN(rest, " ", 2)
+			if len(words) == 1 {
+				typed = rest
+				for _, a := range algorithms {
+					candidates = append(candidates, a+" ")
+				}
+				return completions(candidates, typed), len([]rune(typed))
+			}
+			rest = words[1]
+		}
+		typed = rest
+		candidates = r.names
+	}
+	return completions(candidates, typed), len([]rune(typed))
+}
+
+func completions(candidates []string, typed string) [][]rune {
+	var out [][]rune
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), strings.ToLower(typed)) {
+			out = append(out, []rune(c[len(typed):]))
+		}
+	}
+	return out
+}
+
+// Resolves an element name, ignoring case when there is no exact match
+func (r *repl) element(name string) (*ElementNode, error) {
+	if node, ok := r.elementMap[name]; ok {
+		return node, nil
+	}
+	for _, candidate := range r.names {
+		if strings.EqualFold(candidate, name) {
+			return r.elementMap[candidate], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown element %q", name)
+}
+
+// Splits trailing key=value options from the element name
+func splitOptions(args []string) (string, map[string]string) {
+	opts := make(map[string]string)
+	end := len(args)
+	for end > 0 {
+		key, value, ok := strings.Cut(args[end-1], "=")
+		if !ok {
+			break
+		}
+		opts[key] = value
+		end--
+	}
+	return strings.Join(args[:end], " "), opts
+}
+
+// Applies n=, left=, right=, heuristic= and weight= to opts
+func (r *repl) applyOptions(options map[string]string, opts *SearchOptions) error {
+	for key, value := range options {
+		switch key {
+		case "n":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("n must be a positive number")
+			}
+			opts.RecipeAmount = n
+		case "left":
+			opts.Left = strings.ToUpper(value)
+		case "right":
+			opts.Right = strings.ToUpper(value)
+		case "heuristic":
+			if _, ok := heuristics[strings.ToLower(value)]; !ok {
+				return fmt.Errorf("unknown heuristic %q, expected one of %s", value, strings.Join(heuristicNames(), ", "))
+			}
+			opts.Heuristic = strings.ToLower(value)
+		case "weight":
+			w, err := strconv.ParseFloat(value, 64)
+			if err != nil || !(w >= 1 && w <= maxWeight) {
+				return fmt.Errorf("weight must be between 1 and %g", float64(maxWeight))
+			}
+			opts.Weight = w
+		default:
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
+
+func (r *repl) help(args []string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	width := 0
+	for _, name := range names {
+		width = max(width, len(replCommands[name].usage))
+	}
+	for _, name := range names {
+		fmt.Fprintf(r.out, "  %-*s %s\n", width, replCommands[name].usage, replCommands[name].help)
+	}
+	fmt.Fprintf(r.out, "  %-*s %s\n", width, "quit", "leave the shell")
+	fmt.Fprintln(r.out, "search options: n=, left=, right=, heuristic= and weight=, see set")
+	return nil
+}
+
+func (r *repl) info(args []string) error {
+	node, err := r.element(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%s\n  tier:    %d\n", node.Name, node.Tier)
+	if node.IsBase {
+		fmt.Fprintln(r.out, "  base element")
+	}
+	if node.UnlockAfter > 0 {
+		fmt.Fprintf(r.out, "  unlocked after %d discoveries\n", node.UnlockAfter)
+	}
+	usable := 0
+	for _, recipe := range node.Children {
+		if recipe.usableFor(node.Tier) {
+			usable++
+		}
+	}
+	fmt.Fprintf(r.out, "  recipes: %d (%d usable)\n", len(node.Children), usable)
+	fmt.Fprintf(r.out, "  uses:    %d\n", len(findUses(r.ds.Elements, node.Name)))
+	fmt.Fprintf(r.out, "  trees:   %s\n", r.counter.count(node))
+	if node.ImgSrc != "" {
+		fmt.Fprintf(r.out, "  image:   %s\n", node.ImgSrc)
+	}
+	return nil
+}
+
+func (r *repl) recipes(args []string) error {
+	node, err := r.element(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	if len(node.Children) == 0 {
+		fmt.Fprintf(r.out, "%s has no recipes\n", node.Name)
+	}
+	for _, recipe := range node.Children {
+		note := ""
+		if !recipe.usableFor(node.Tier) {
+			note = "  (not lower tier, ignored by searches)"
+		}
+		fmt.Fprintf(r.out, "  %s%s\n", recipe, note)
+	}
+	return nil
+}
+
+func (r *repl) uses(args []string) error {
+	node, err := r.element(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	uses := findUses(r.ds.Elements, node.Name)
+	for _, use := range uses {
+		fmt.Fprintf(r.out, "  %s -> %s (tier %d)\n", strings.Join(use.Ingredients, " + "), use.Result, use.Tier)
+	}
+	fmt.Fprintf(r.out, "%s is used in %d recipes\n", node.Name, len(uses))
+	return nil
+}
+
+func (r *repl) run(opts SearchOptions) (ExportableElement, time.Duration, error) {
+	start := time.Now()
+	tree, err := runSearch(quietContext(false), r.ds.Elements, opts, nil)
+	return tree, time.Since(start), err
+}
+
+func (r *repl) search(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s", replCommands["search"].usage)
+	}
+	algorithm := ""
+	for _, a := range algorithms {
+		if strings.EqualFold(a, args[0]) {
+			algorithm = a
+		}
+	}
+	if algorithm == "" {
+		return fmt.Errorf("unknown algorithm %q", args[0])
+	}
+	name, options := splitOptions(args[1:])
+	node, err := r.element(name)
+	if err != nil {
+		return err
+	}
+	opts := r.defaults
+	if err := r.applyOptions(options, &opts); err != nil {
+		return err
+	}
+	opts.Element = node.Name
+	opts.Algorithm = algorithm
+	tree, elapsed, err := r.run(opts)
+	if err != nil {
+		return err
+	}
+	r.tree = &tree
+	r.path = []*ExportableElement{r.tree}
+	writeTreeText(r.out, tree, 0)
+	fmt.Fprintf(r.out, "%s in %s, %d nodes\n", algorithm, elapsed.Round(time.Microsecond), treeSize(tree))
+	return nil
+}
+
+// Number of element nodes in an exported tree
+func treeSize(el ExportableElement) int {
+	n := 1
+	for _, recipe := range el.Children {
+		for _, ing := range recipe.Children {
+			n += treeSize(ing)
+		}
+	}
+	return n
+}
+
+func treeDepth(el ExportableElement) int {
+	depth := 0
+	for _, recipe := range el.Children {
+		for _, ing := range recipe.Children {
+			depth = max(depth, treeDepth(ing)+1)
+		}
+	}
+	return depth
+}
+
+func (r *repl) compare(args []string) error {
+	name, options := splitOptions(args)
+	node, err := r.element(name)
+	if err != nil {
+		return err
+	}
+	defaults := r.defaults
+	if err := r.applyOptions(options, &defaults); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "  %-24s %12s %8s %8s %8s\n", "algorithm", "time", "nodes", "depth", "recipes")
+	for _, opts := range benchCases {
+		opts.Element = node.Name
+		opts.RecipeAmount = defaults.RecipeAmount
+		label := opts.Algorithm
+		if opts.Algorithm == "Bidirectional" {
+			label += " " + opts.Left + "/" + opts.Right
+		}
+		tree, elapsed, err := r.run(opts)
+		if err != nil {
+			fmt.Fprintf(r.out, "  %-24s error: %v\n", label, err)
+			continue
+		}
+		fmt.Fprintf(r.out, "  %-24s %12s %8d %8d %8d\n", label, elapsed.Round(time.Microsecond), treeSize(tree), treeDepth(tree), len(tree.Children))
+	}
+	return nil
+}
+
+func (r *repl) current() (*ExportableElement, error) {
+	if len(r.path) == 0 {
+		return nil, fmt.Errorf("no tree yet, run search first")
+	}
+	return r.path[len(r.path)-1], nil
+}
+
+func (r *repl) showTree(args []string) error {
+	tree, err := r.current()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(r.path))
+	for i, el := range r.path {
+		names[i] = el.Name
+	}
+	fmt.Fprintln(r.out, strings.Join(names, " > "))
+	writeTreeText(r.out, *tree, 0)
+	return nil
+}
+
+func (r *repl) into(args []string) error {
+	tree, err := r.current()
+	if err != nil {
+		return err
+	}
+	name := strings.Join(args, " ")
+	// Breadth first so the shallowest occurrence wins
+	queue := []*ExportableElement{tree}
+	for len(queue) > 0 {
+		el := queue[0]
+		queue = queue[1:]
+		if el != tree && strings.EqualFold(el.Name, name) {
+			r.path = append(r.path, el)
+			return r.showTree(nil)
+		}
+		for i := range el.Children {
+			for j := range el.Children[i].Children {
+				queue = append(queue, &el.Children[i].Children[j])
+			}
+		}
+	}
+	return fmt.Errorf("%s is not in the current tree", name)
+}
+
+func (r *repl) up(args []string) error {
+	if len(r.path) <= 1 {
+		return fmt.Errorf("already at the top")
+	}
+	r.path = r.path[:len(r.path)-1]
+	return r.showTree(nil)
+}
+
+func (r *repl) count(args []string) error {
+	node, err := r.element(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "%s: %s\n", node.Name, r.counter.count(node))
+	return nil
+}
+
+func (r *repl) set(args []string) error {
+	_, options := splitOptions(args)
+	if err := r.applyOptions(options, &r.defaults); err != nil {
+		return err
+	}
+	d := r.defaults
+	heuristic := d.Heuristic
+	if heuristic == "" {
+		heuristic = defaultHeuristic
+	}
+	fmt.Fprintf(r.out, "n=%d left=%s right=%s heuristic=%s weight=%g\n", d.RecipeAmount, d.Left, d.Right, heuristic, max(d.Weight, 1))
+	return nil
+}
+
+func (r *repl) stats(args []string) error {
+	recipes, usable, maxTier := 0, 0, 0
+	perTier := make(map[int]int)
+	for _, node := range r.elementMap {
+		perTier[node.Tier]++
+		maxTier = max(maxTier, node.Tier)
+		for _, recipe := range node.Children {
+			recipes++
+			if recipe.usableFor(node.Tier) {
+				usable++
+			}
+		}
+	}
+	report := checkTiers(r.ds.Elements, r.ds.Base)
+	fmt.Fprintf(r.out, "dataset %s (%s)\n", r.ds.Name, r.ds.Version)
+	fmt.Fprintf(r.out, "  elements:     %d\n", len(r.elementMap))
+	fmt.Fprintf(r.out, "  base:         %s\n", strings.Join(r.ds.Base, ", "))
+	fmt.Fprintf(r.out, "  recipes:      %d (%d usable)\n", recipes, usable)
+	fmt.Fprintf(r.out, "  unreachable:  %d\n", len(report.Unreachable))
+	fmt.Fprintf(r.out, "  tier errors:  %d\n", len(report.Mismatches))
+	for tier := 0; tier <= maxTier; tier++ {
+		if perTier[tier] > 0 {
+			fmt.Fprintf(r.out, "  tier %-3d      %d\n", tier, perTier[tier])
+		}
+	}
+	return nil
+}
+
+func (r *repl) exec(line string) error {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	cmd, ok := replCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	return cmd.run(r, args[1:])
+}
+
+// repl opens an interactive shell over a dataset
+func replCommand(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	history := fs.String("history", "", "file the command history is kept in")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	r := newRepl(ds, os.Stdout)
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          ds.Name + "> ",
+		HistoryFile:     *history,
+		AutoComplete:    r,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "quit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	r.out = rl.Stdout()
+	fmt.Fprintf(r.out, "Loaded %s with %d elements, type help for the commands\n", ds.Name, len(ds.Elements))
+
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		line = strings.TrimSpace(line)
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		if err := r.exec(line); err != nil {
+			fmt.Fprintln(r.out, "Error:", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testRepl(tb testing.TB) (*repl, *bytes.Buffer) {
+	tb.Helper()
+	elements := testElements(tb, generatorOptions{Elements: 30, Base: 4, Tiers: 5, Recipes: 2, MinIngredients: 2, MaxIngredients: 3, Seed: 1})
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ds, err := parseDataset("test", jsonBytes, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var out bytes.Buffer
+	return newRepl(ds, &out), &out
+}
+
+// Every algorithm a search can run is offered after "search "
+func TestReplCompletesAlgorithms(t *testing.T) {
+	r, _ := testRepl(t)
+	line := []rune("search ")
+	got, _ := r.Do(line, len(line))
+	offered := make(map[string]bool)
+	for _, c := range got {
+		offered[strings.TrimSpace(string(c))] = true
+	}
+	for _, a := range algorithms {
+		if !offered[a] {
+			t.Errorf("%s not offered, got %q", a, got)
+		}
+	}
+
+	line = []rune("search AS")
+	if got, n := r.Do(line, len(line)); len(got) != 1 || string(got[0]) != "tar " || n != 2 {
+		t.Errorf("completing AS: %q, %d", got, n)
+	}
+}
+
+// heuristic= and weight= reach AStar, as options of search and through set
+func TestReplSearchOptions(t *testing.T) {
+	r, out := testRepl(t)
+	if err := r.search([]string{"AStar", "T4E1", "heuristic=zero", "weight=2"}); err != nil {
+		t.Fatal(err)
+	}
+	stats, ok := r.tree.Meta["search"].(*astarStats)
+	if !ok {
+		t.Fatalf("no search stats in %v", r.tree.Meta)
+	}
+	if stats.Heuristic != "zero" || stats.Weight != 2 {
+		t.Errorf("searched with %s weight %g, want zero weight 2", stats.Heuristic, stats.Weight)
+	}
+
+	out.Reset()
+	if err := r.set([]string{"heuristic=Tier", "weight=1.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "heuristic=tier weight=1.5"; !strings.Contains(out.String(), want) {
+		t.Errorf("set printed %q, want %q", out.String(), want)
+	}
+	if err := r.search([]string{"astar", "T4E1"}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.tree.Meta["search"].(*astarStats); stats.Heuristic != "tier" || stats.Weight != 1.5 {
+		t.Errorf("searched with %s weight %g, want the defaults tier weight 1.5", stats.Heuristic, stats.Weight)
+	}
+
+	for _, bad := range []string{"heuristic=nope", "weight=0.5", "weight=x"} {
+		if err := r.search([]string{"AStar", "T4E1", bad}); err == nil {
+			t.Errorf("no error for %s", bad)
+		}
+	}
+}
+
+// Every command prints what it is about, or fails with an error
+func TestReplCommands(t *testing.T) {
+	r, out := testRepl(t)
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"help", []string{"search ", "compare ELEMENT", "quit"}},
+		{"info t4e1", []string{"T4E1", "tier:    4", "trees:"}},
+		{"info Base1", []string{"base element"}},
+		{"recipes T4E1", []string{" + "}},
+		{"recipes Base1", []string{"Base1 has no recipes"}},
+		{"uses Base1", []string{"Base1 is used in"}},
+		{"count T3E1", []string{"T3E1: "}},
+		{"compare T3E1 n=2", []string{"algorithm", "Bidirectional DFS/BFS", "AStar"}},
+		{"stats", []string{"dataset test", "elements:     30", "tier 5"}},
+		{"set n=3 left=BFS", []string{"n=3 left=BFS right=BFS"}},
+		{"search BFS T4E1", []string{"BFS in", "nodes"}},
+		{"tree", []string{"T4E1\n"}},
+	}
+	for _, c := range cases {
+		out.Reset()
+		if err := r.exec(c.line); err != nil {
+			t.Errorf("%s: %v", c.line, err)
+			continue
+		}
+		for _, want := range c.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s printed %q, want %q", c.line, out.String(), want)
+			}
+		}
+	}
+
+	for _, line := range []string{"nope", "info Nope", "search BFS", "search Nope T4E1", "search BFS T4E1 n=x", "into Nope"} {
+		if err := r.exec(line); err == nil {
+			t.Errorf("%s: no error", line)
+		}
+	}
+}
+
+// into walks down the last tree and up walks back to its root
+func TestReplTreeNavigation(t *testing.T) {
+	r, out := testRepl(t)
+	for _, line := range []string{"tree", "up", "into T1E1"} {
+		if err := r.exec(line); err == nil {
+			t.Errorf("%s before any search: no error", line)
+		}
+	}
+	if err := r.exec("search BFS T4E1"); err != nil {
+		t.Fatal(err)
+	}
+	child := r.tree.Children[0].Children[0].Name
+	out.Reset()
+	if err := r.exec("into " + child); err != nil {
+		t.Fatal(err)
+	}
+	if want := "T4E1 > " + child; !strings.HasPrefix(out.String(), want) {
+		t.Errorf("into printed %q, want %q first", out.String(), want)
+	}
+	if err := r.exec("up"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.path) != 1 {
+		t.Errorf("path of %d trees after up, want the root", len(r.path))
+	}
+	if err := r.exec("up"); err == nil {
+		t.Error("up at the root: no error")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Largest number of trees drawn by one request
+const maxSampleAmount = 1000
+
+// uniform draws every complete tree with the same probability, weighted a
+// tree with probability proportional to e^-cost, favouring cheap trees
+var sampleModes = []string{"uniform", "weighted"}
+
+type sampleOptions struct {
+	Element string
+	Amount  int
+	Seed    int64
+	Mode    string
+	Costs   map[string]float64
+	Owned   []string
+}
+
+func (opts sampleOptions) validate() error {
+	if opts.Element == "" {
+		return fmt.Errorf("element name is required")
+	}
+	if opts.Amount < 1 || opts.Amount > maxSampleAmount {
+		return fmt.Errorf("k must be between 1 and %d", maxSampleAmount)
+	}
+	if opts.Seed < 0 {
+		return fmt.Errorf("seed must be at least 0")
+	}
+	if !contains(sampleModes, opts.Mode) {
+		return fmt.Errorf("unknown mode %q, expected one of %s", opts.Mode, strings.Join(sampleModes, ", "))
+	}
+	return nil
+}
+
+// Seed for a request without one, below 2^53 so it survives JSON numbers
+func randomSeed() int64 {
+	return rand.Int63n(1 << 53)
+}
+
+type treeSampler struct {
+	counter  *treeCounter
+	weighted bool
+	rng      *rand.Rand
+	// Log of the sum of e^-cost over every tree of an element
+	logWeights map[*ElementNode]float64
+}
+
+func (s *treeSampler) logWeight(node *ElementNode) float64 {
+	if w, ok := s.logWeights[node]; ok {
+		return w
+	}
+	w := math.Inf(-1)
+	if node.IsBase {
+		w = -node.Cost
+	} else {
+		for _, recipe := range node.Children {
+			if recipe.usableFor(node.Tier) {
+				w = logAddExp(w, s.recipeLogWeight(recipe))
+			}
+		}
+	}
+	s.logWeights[node] = w
+	return w
+}
+
+func (s *treeSampler) recipeLogWeight(recipe *RecipeNode) float64 {
+	w := -recipe.Cost
+	for _, ing := range recipe.Ingredients {
+		w += s.logWeight(ing)
+	}
+	return w
+}
+
+// log(e^a + e^b) without overflowing
+func logAddExp(a, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
+
+// Picks a recipe of node with probability proportional to its number of
+// trees, or to their total weight, then every ingredient independently, so
+// the whole tree is drawn from the wanted distribution. node must have at
+// least one tree, of a finite weight when weighted.
+func (s *treeSampler) sample(node *ElementNode) ExportableElement {
+	tree := exportLeaf(node)
+	if node.IsBase {
+		return tree
+	}
+	var picked *RecipeNode
+	if s.weighted {
+		u := s.rng.Float64()
+		total := s.logWeight(node)
+		for _, recipe := range node.Children {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			p := math.Exp(s.recipeLogWeight(recipe) - total)
+			if p > 0 {
+				picked = recipe
+			}
+			if u -= p; u < 0 && p > 0 {
+				break
+			}
+		}
+	} else {
+		r := new(big.Int).Rand(s.rng, s.counter.count(node))
+		for _, recipe := range node.Children {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			product := big.NewInt(1)
+			for _, ing := range recipe.Ingredients {
+				product.Mul(product, s.counter.count(ing))
+			}
+			if r.Cmp(product) < 0 {
+				picked = recipe
+				break
+			}
+			r.Sub(r, product)
+		}
+	}
+
+	ingredients := make([]ExportableElement, len(picked.Ingredients))
+	for i, ing := range picked.Ingredients {
+		ingredients[i] = s.sample(ing)
+	}
+	tree.Children = []ExportableRecipe{{Attributes: "recipe", Children: ingredients}}
+	return tree
+}
+
+// Draws opts.Amount complete trees of an element, with replacement. Each
+// tree is one recipe child of the returned root as in search results, the
+// same seed draws the same trees from the same dataset.
+func sampleTrees(rawElements []Element, opts sampleOptions) (ExportableElement, error) {
+	if err := opts.validate(); err != nil {
+		return ExportableElement{}, err
+	}
+	rawElements, err := applyCostOptions(rawElements, SearchOptions{Costs: opts.Costs, Owned: opts.Owned})
+	if err != nil {
+		return ExportableElement{}, err
+	}
+	elementMap, _ := buildGraph(rawElements)
+	root, exists := elementMap[opts.Element]
+	if !exists {
+		return ExportableElement{}, errElementNotFound
+	}
+	counter := newTreeCounter(elementMap)
+	available := counter.count(root)
+	if available.Sign() == 0 {
+		return ExportableElement{}, fmt.Errorf("%s has no complete tree", root.Name)
+	}
+
+	s := &treeSampler{
+		counter:    counter,
+		weighted:   opts.Mode == "weighted",
+		rng:        rand.New(rand.NewSource(opts.Seed)),
+		logWeights: make(map[*ElementNode]float64),
+	}
+	// e^-cost rounds to 0 for every tree once the costs add up past the
+	// largest float, such weights cannot be compared
+	if s.weighted && math.IsInf(s.logWeight(root), -1) {
+		return ExportableElement{}, fmt.Errorf("the trees of %s cost too much to be weighted", root.Name)
+	}
+	result := exportLeaf(root)
+	result.Children = []ExportableRecipe{}
+	distinct := make(map[string]bool)
+	for i := 0; i < opts.Amount && !root.IsBase; i++ {
+		tree := s.sample(root)
+		result.Children = append(result.Children, tree.Children[0])
+		distinct[treeKey(tree.Children[0])] = true
+	}
+	result.Meta = map[string]any{
+		"trees":          len(result.Children),
+		"treesAvailable": available.String(),
+		"distinct":       len(distinct),
+		"seed":           opts.Seed,
+		"mode":           opts.Mode,
+	}
+	if root.IsBase {
+		result.Meta["trees"] = 1
+		result.Meta["distinct"] = 1
+	}
+	if s.weighted || len(opts.Costs) > 0 || len(opts.Owned) > 0 || hasCosts(rawElements) {
+		result.Meta["costs"] = annotateCosts(&result, elementMap)
+	}
+	return result, nil
+}
+
+// Same for two trees exactly when they use the same recipes in the same places
+func treeKey(recipe ExportableRecipe) string {
+	var b strings.Builder
+	var walk func(recipe ExportableRecipe)
+	walk = func(recipe ExportableRecipe) {
+		b.WriteByte('(')
+		for i, ing := range recipe.Children {
+			if i > 0 {
+				b.WriteByte('+')
+			}
+			b.WriteString(ing.Name)
+			for _, sub := range ing.Children {
+				walk(sub)
+			}
+		}
+		b.WriteByte(')')
+	}
+	walk(recipe)
+	return b.String()
+}
+
+// GET /sample/{element}?k=&seed=&mode= draws k random trees of an element
+func sampleHandler(registry *datasetRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		opts := sampleOptions{
+			Element: strings.TrimPrefix(r.URL.Path, "/sample/"),
+			Amount:  1,
+			Seed:    randomSeed(),
+			Mode:    "uniform",
+			Owned:   splitList(query.Get("owned")),
+		}
+		if k := query.Get("k"); k != "" {
+			n, err := strconv.Atoi(k)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid k %q, expected 1 to %d", k, maxSampleAmount)})
+				return
+			}
+			opts.Amount = n
+		}
+		if seed := query.Get("seed"); seed != "" {
+			n, err := strconv.ParseInt(seed, 10, 64)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid seed %q", seed)})
+				return
+			}
+			opts.Seed = n
+		}
+		if mode := query.Get("mode"); mode != "" {
+			opts.Mode = mode
+		}
+		var err error
+		if opts.Costs, err = parseCosts(query.Get("cost")); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		result, err := sampleTrees(ds.Elements, opts)
+		if errors.Is(err, errElementNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		result.Meta["datasetVersion"] = ds.Version
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// sample draws random trees of an element and prints them
+func sampleCommand(args []string) error {
+	fs := flag.NewFlagSet("sample", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	amount := fs.Int("k", 1, "number of trees to draw")
+	seed := fs.Int64("seed", -1, "random seed (default: a new one, printed on stderr)")
+	mode := fs.String("mode", "uniform", "distribution of the trees: "+strings.Join(sampleModes, ", "))
+	costList := fs.String("cost", "", "element costs replacing the dataset's, e.g. Fire:2,Steam:0.5")
+	owned := fs.String("owned", "", "comma separated elements already owned, used as free leaves")
+	format := fs.String("format", "text", "output format: text, json, dot or steps")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: sample [flags] ELEMENT\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one element name")
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	costs, err := parseCosts(*costList)
+	if err != nil {
+		return err
+	}
+	if *seed < 0 {
+		*seed = randomSeed()
+		fmt.Fprintf(os.Stderr, "Seed: %d\n", *seed)
+	}
+	tree, err := sampleTrees(ds.Elements, sampleOptions{
+		Element: positional[0],
+		Amount:  *amount,
+		Seed:    *seed,
+		Mode:    *mode,
+		Costs:   costs,
+		Owned:   splitList(*owned),
+	})
+	if err != nil {
+		return err
+	}
+	return writeTree(os.Stdout, tree, *format)
+}
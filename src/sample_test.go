@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Share of the trees of X using B rather than C, X being A+B or A+C
+func TestSampleModes(t *testing.T) {
+	elements := []Element{
+		{Name: "A", Base: true},
+		{Name: "B", Base: true},
+		{Name: "C", Base: true},
+		{Name: "X", Tier: 1, Recipes: [][]string{{"A", "B"}, {"A", "C"}}},
+	}
+	cases := []struct {
+		name  string
+		mode  string
+		costs map[string]float64
+		// Expected share of A+B, negative when sampling must fail
+		want float64
+	}{
+		{"uniform", "uniform", nil, 0.5},
+		{"uniform ignores costs", "uniform", map[string]float64{"B": 0, "C": math.Log(3)}, 0.5},
+		{"weighted without costs", "weighted", map[string]float64{"B": 0, "C": 0}, 0.5},
+		{"weighted", "weighted", map[string]float64{"B": 0, "C": math.Log(3)}, 0.75},
+		{"one recipe overflows", "weighted", map[string]float64{"A": 1.7e308, "B": 1.7e308, "C": 0}, 0},
+		{"every recipe overflows", "weighted", map[string]float64{"A": 1.7e308, "B": 1.7e308, "C": 1.7e308}, -1},
+	}
+	const draws = maxSampleAmount
+	for _, c := range cases {
+		tree, err := sampleTrees(elements, sampleOptions{Element: "X", Amount: draws, Seed: 1, Mode: c.mode, Costs: c.costs})
+		if c.want < 0 {
+			if err == nil {
+				t.Errorf("%s: no error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		withB := 0
+		for _, recipe := range tree.Children {
+			if recipe.Children[1].Name == "B" {
+				withB++
+			}
+		}
+		if got := float64(withB) / draws; math.Abs(got-c.want) > 0.05 {
+			t.Errorf("%s: %.3f of the trees use B, want %.2f", c.name, got, c.want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -10,10 +12,95 @@ import (
 )
 
 type Element struct {
-	Name    string      `json:"name"`
-	Tier    int         `json:"tier"`
-	Recipes [][2]string `json:"recipes"`
-	ImgSrc  string      `json:"img_src"`
+	Name string `json:"name"`
+	Tier int    `json:"tier"`
+	// Each recipe lists its ingredients, usually two
+	Recipes [][]string `json:"recipes"`
+	ImgSrc  string     `json:"img_src"`
+	// Starting element, a leaf for every algorithm
+	Base   bool    `json:"base,omitempty"`
+	Unlock *Unlock `json:"unlock,omitempty"`
+	// Cost of every recipe of a crafted element or of using a base
+	// element, RecipeCosts overrides it per recipe. See cost.go.
+	Cost        *float64  `json:"cost,omitempty"`
+	RecipeCosts []float64 `json:"recipe_costs,omitempty"`
+}
+
+// Condition for special elements that are not crafted, like Time
+type Unlock struct {
+	// Number of elements the player must have discovered
+	Discoveries int `json:"discoveries"`
+}
+
+// Special elements of Little Alchemy 2 and how they are unlocked
+var la2Unlocks = map[string]Unlock{
+	"Time": {Discoveries: 100},
+}
+
+// Headings of the tier 0 sections: starting elements, and special elements
+// that are unlocked instead of crafted
+var tierZeroHeadings = []string{"Starting elements", "Special elements"}
+
+// Tier of an <h3> heading of the element list: the tierZeroHeadings are
+// tier 0, "Tier N elements" is N. ok is false for any other heading, so
+// an unrelated heading does not move the following rows to another tier.
+func parseTierHeading(heading string) (tier int, ok bool) {
+	heading = strings.TrimSpace(heading)
+	for _, zero := range tierZeroHeadings {
+		if strings.EqualFold(heading, zero) {
+			return 0, true
+		}
+	}
+	rest, found := strings.CutPrefix(heading, "Tier ")
+	if !found {
+		return 0, false
+	}
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	tier, err := strconv.Atoi(rest[:digits])
+	if err != nil {
+		return 0, false
+	}
+	return tier, true
+}
+
+// Element of one table row, ok is false for rows that are not elements
+func parseElementRow(row *goquery.Selection, tier int) (Element, bool) {
+	var elmt Element
+	tds := row.Find("td")
+	if tds.Length() < 2 {
+		return elmt, false
+	}
+	title := tds.Eq(0).Find("a[title]").First().AttrOr("title", "")
+	if title == "" || title == "Elements (Little Alchemy 1)" {
+		return elmt, false
+	}
+	elmt.Name = title
+	if unlock, ok := la2Unlocks[elmt.Name]; ok {
+		elmt.Unlock = &unlock
+	}
+
+	imgSrc, exists := tds.Eq(0).Find("img").First().Attr("data-src")
+	if !exists {
+		imgSrc = tds.Eq(0).Find("img").First().AttrOr("src", "")
+	}
+	elmt.ImgSrc = imgSrc
+
+	elmt.Tier = tier
+	tds.Eq(1).Find("li").Each(func(i int, li *goquery.Selection) {
+		var ingredients []string
+		li.Find("a[title]").Each(func(j int, a *goquery.Selection) {
+			if title := a.AttrOr("title", ""); title != "" {
+				ingredients = append(ingredients, title)
+			}
+		})
+		if len(ingredients) > 0 {
+			elmt.Recipes = append(elmt.Recipes, ingredients)
+		}
+	})
+	return elmt, true
 }
 
 func scrape() []Element {
@@ -24,62 +111,20 @@ func scrape() []Element {
 	c.OnHTML("tr, h3", func(e *colly.HTMLElement) {
 		if e.Name == "h3" {
 			// Save the current <h3> tier title
-			tier := strings.TrimSpace(e.DOM.Find("span.mw-headline").Text())
-			if len(tier) == 0 {
+			heading := strings.TrimSpace(e.DOM.Find("span.mw-headline").Text())
+			tier, ok := parseTierHeading(heading)
+			if !ok {
 				return
 			}
-			if tier == "Starting elements" {
-				fmt.Println("Starting elements")
-				currentTier = 0
-			} else {
-				currentTier = int(tier[5] - '0')
-				if tier[6] != ' ' {
-					currentTier = currentTier*10 + int(tier[6]-'0')
-				}
-				fmt.Println("Current tier:", currentTier)
-			}
+			currentTier = tier
+			fmt.Fprintf(os.Stderr, "%s: tier %d\n", heading, currentTier)
 			return
 		}
 
-		tds := e.DOM.Find("td")
-		if tds.Length() < 2 {
+		elmt, ok := parseElementRow(e.DOM, currentTier)
+		if !ok {
 			return
 		}
-
-		var elmt Element
-		if tds.Eq(0).Find("a[title]").First().AttrOr("title", "") == "Elements (Little Alchemy 1)" {
-			return
-		}
-
-		elmt.Name = tds.Eq(0).Find("a[title]").First().AttrOr("title", "")
-		if elmt.Name == "Time" {
-			fmt.Println("Skipping Time element")
-			return
-		}
-
-		imgSrc, exists := tds.Eq(0).Find("img").First().Attr("data-src")
-		if !exists {
-			imgSrc = tds.Eq(0).Find("img").First().AttrOr("src", "")
-		}
-		elmt.ImgSrc = imgSrc
-
-
-		// fmt.Printf("Element: %s, ImgSrc: %s\n", elmt.Name, imgSrc)
-
-		elmt.Tier = currentTier
-		tds.Eq(1).Find("li").Each(func(i int, li *goquery.Selection) {
-			var ingredients [2]string
-			li.Find("a[title]").Each(func(j int, a *goquery.Selection) {
-				if a.AttrOr("title", "") == "Time" {
-					fmt.Println("Skipping Time recipe for element:", elmt.Name)
-					return
-				}
-				ingredients[j] = a.AttrOr("title", "")
-			})
-			if ingredients[0] != "" && ingredients[1] != "" {
-				elmt.Recipes = append(elmt.Recipes, ingredients)
-			}
-		})
 		recipeMap = append(recipeMap, elmt)
 	})
 
@@ -94,11 +139,11 @@ func scrape() []Element {
 func convertToJson(recipes []Element) ([]byte, error) {
 	jsonBytes, err := json.MarshalIndent(recipes, "", "  ")
 	if err != nil {
-		fmt.Println("Error marshalling to JSON:", err)
+		fmt.Fprintln(os.Stderr, "Error marshalling to JSON:", err)
 		return nil, err
 	}
 	if jsonBytes == nil {
-		fmt.Println("jsonBytes is nil")
+		fmt.Fprintln(os.Stderr, "jsonBytes is nil")
 		return nil, fmt.Errorf("jsonBytes is nil")
 	}
 	return jsonBytes, nil
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+)
+
+const la1URL = "https://little-alchemy.fandom.com/wiki/Elements_(Little_Alchemy_1)"
+
+var la1BaseElements = []string{"Air", "Earth", "Fire", "Water"}
+
+// LA1 element links point at "<name> (Little Alchemy 1)" pages
+func la1Name(title string) string {
+	return strings.TrimSpace(strings.TrimSuffix(title, "(Little Alchemy 1)"))
+}
+
+// The LA1 list is one table without tier headings, so tiers are computed
+// from the recipes instead
+func scrapeLA1() []Element {
+	c := colly.NewCollector()
+	var elements []Element
+	seen := make(map[string]bool)
+
+	c.OnHTML("tr", func(e *colly.HTMLElement) {
+		tds := e.DOM.Find("td")
+		if tds.Length() < 2 {
+			return
+		}
+		title := tds.Eq(0).Find("a[title]").First().AttrOr("title", "")
+		// Skip empty cells and the navigation rows linking the game lists
+		if title == "" || strings.HasPrefix(title, "Elements (") {
+			return
+		}
+
+		var elmt Element
+		elmt.Name = la1Name(title)
+		if seen[elmt.Name] {
+			return
+		}
+		seen[elmt.Name] = true
+
+		imgSrc, exists := tds.Eq(0).Find("img").First().Attr("data-src")
+		if !exists {
+			imgSrc = tds.Eq(0).Find("img").First().AttrOr("src", "")
+		}
+		elmt.ImgSrc = imgSrc
+
+		tds.Eq(1).Find("li").Each(func(i int, li *goquery.Selection) {
+			links := li.Find("a[title]")
+			if links.Length() != 2 {
+				return
+			}
+			ingredients := []string{
+				la1Name(links.Eq(0).AttrOr("title", "")),
+				la1Name(links.Eq(1).AttrOr("title", "")),
+			}
+			if ingredients[0] != "" && ingredients[1] != "" {
+				elmt.Recipes = append(elmt.Recipes, ingredients)
+			}
+		})
+		elements = append(elements, elmt)
+	})
+
+	c.Visit(la1URL)
+
+	tiers := computeTiers(elements, la1BaseElements)
+	var reachable []Element
+	for _, el := range elements {
+		tier, ok := tiers[el.Name]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Skipping LA1 element without a recipe from the base:", el.Name)
+			continue
+		}
+		el.Tier = tier
+		reachable = append(reachable, el)
+	}
+	fmt.Fprintf(os.Stderr, "Scraped %d Little Alchemy 1 elements\n", len(reachable))
+	return reachable
+}
+
+// Scrapers by game, used for scrape:<game> dataset sources
+var scrapers = map[string]func() []Element{
+	"la1": scrapeLA1,
+	"la2": scrape,
+}
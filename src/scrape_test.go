@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseTierHeading(t *testing.T) {
+	cases := []struct {
+		heading string
+		tier    int
+		ok      bool
+	}{
+		{"Starting elements", 0, true},
+		{" Special elements ", 0, true},
+		{"Tier 1 elements", 1, true},
+		{"Tier 12 elements", 12, true},
+		{"Tier x elements", 0, false},
+		{"Tier", 0, false},
+		{"", 0, false},
+		{"Trivia", 0, false},
+		{"Navigation menu", 0, false},
+	}
+	for _, c := range cases {
+		tier, ok := parseTierHeading(c.heading)
+		if tier != c.tier || ok != c.ok {
+			t.Errorf("parseTierHeading(%q) = %d, %t, want %d, %t", c.heading, tier, ok, c.tier, c.ok)
+		}
+	}
+}
+
+func FuzzParseTierHeading(f *testing.F) {
+	for _, heading := range []string{
+		"Starting elements", "Special elements", "Tier 1 elements", "Tier 12 elements",
+		"Tier ", "Tier", "Tier 5", "Tier x elements", " Tier 3 elements ",
+	} {
+		f.Add(heading)
+	}
+	f.Fuzz(func(t *testing.T, heading string) {
+		tier, ok := parseTierHeading(heading)
+		if tier < 0 {
+			t.Errorf("negative tier %d", tier)
+		}
+		if !ok && tier != 0 {
+			t.Errorf("tier %d for a rejected heading", tier)
+		}
+	})
+}
+
+func FuzzParseElementRow(f *testing.F) {
+	for _, row := range []string{
+		`<td><a title="Fire" href="/wiki/Fire"><img data-src="fire.png"></a></td><td><ul><li><a title="Air"></a> + <a title="Water"></a></li></ul></td>`,
+		`<td><a title="Time"><img src="time.png"></a></td><td>Unlocked after 100 discoveries</td>`,
+		`<td><a title="Elements (Little Alchemy 1)"></a></td><td></td>`,
+		`<td></td>`,
+		`<td><img></td><td><li><a title=""></a></li></td>`,
+	} {
+		f.Add(row)
+	}
+	f.Fuzz(func(t *testing.T, row string) {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<table><tr>" + row + "</tr></table>"))
+		if err != nil {
+			return
+		}
+		doc.Find("tr").Each(func(i int, row *goquery.Selection) {
+			el, ok := parseElementRow(row, 3)
+			if !ok {
+				return
+			}
+			if el.Name == "" {
+				t.Errorf("element without a name")
+			}
+			for _, r := range el.Recipes {
+				if len(r) == 0 || contains(r, "") {
+					t.Errorf("recipe %v of %s has an empty ingredient", r, el.Name)
+				}
+			}
+		})
+	})
+}
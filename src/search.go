@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecipeAmount is the number of distinct complete trees returned, fewer
+// only when the element has fewer
+type SearchOptions struct {
+	Dataset      string `json:"dataset,omitempty"`
+	Element      string `json:"element"`
+	Algorithm    string `json:"algorithm"`
+	RecipeAmount int    `json:"recipeAmount"`
+	Left         string `json:"left,omitempty"`
+	Right        string `json:"right,omitempty"`
+	NoCache      bool   `json:"noCache,omitempty"`
+	// Best-first search only, see astar
+	Heuristic string  `json:"heuristic,omitempty"`
+	Weight    float64 `json:"weight,omitempty"`
+	// Element costs replacing the dataset's, and elements the player
+	// already has, used as free leaves
+	Costs map[string]float64 `json:"costs,omitempty"`
+	Owned []string           `json:"owned,omitempty"`
+	// Returns the most different trees instead of the first ones, see
+	// collectDiverse
+	Diverse bool `json:"diverse,omitempty"`
+}
+
+var errElementNotFound = errors.New("element not found")
+
+// Keeps the recipe budget of DFS_Multiple within int32
+const maxRecipeAmount = 100000
+
+// Largest weight of the best-first search heuristic
+const maxWeight = 100
+
+// Algorithms a search can run, each also served under /{algorithm}/
+var algorithms = []string{"DFS", "BFS", "Bidirectional", "IDDFS", "AStar"}
+
+func (opts SearchOptions) validate() error {
+	if opts.Element == "" {
+		return fmt.Errorf("element name is required")
+	}
+	if opts.RecipeAmount < 1 || opts.RecipeAmount > maxRecipeAmount {
+		return fmt.Errorf("recipeAmount must be between 1 and %d", maxRecipeAmount)
+	}
+	if !contains(algorithms, opts.Algorithm) {
+		return fmt.Errorf("unknown algorithm %q", opts.Algorithm)
+	}
+	if _, ok := heuristics[opts.Heuristic]; opts.Heuristic != "" && !ok {
+		return fmt.Errorf("unknown heuristic %q, expected one of %s", opts.Heuristic, strings.Join(heuristicNames(), ", "))
+	}
+	if opts.Diverse && opts.RecipeAmount > maxDiverseAmount {
+		return fmt.Errorf("recipeAmount must be at most %d for diverse results", maxDiverseAmount)
+	}
+	if opts.Weight != 0 && !(opts.Weight >= 1 && opts.Weight <= maxWeight) {
+		return fmt.Errorf("weight must be between 1 and %g", float64(maxWeight))
+	}
+	return nil
+}
+
+type searchLogKey struct{}
+
+// Makes the searches run with ctx log their steps to w instead of stdout
+func withSearchLog(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, searchLogKey{}, w)
+}
+
+// Writer the algorithms log their steps to
+func searchLog(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(searchLogKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+type graphLockKey struct{}
+
+// Makes the searches run with ctx guard the nodes they write with mu, so
+// the two sides of a bidirectional search can share the graph
+func withGraphLock(ctx context.Context, mu *sync.Mutex) context.Context {
+	return context.WithValue(ctx, graphLockKey{}, mu)
+}
+
+// Lock of the nodes shared with other searches, a new one when alone
+func graphLock(ctx context.Context) *sync.Mutex {
+	if mu, ok := ctx.Value(graphLockKey{}).(*sync.Mutex); ok {
+		return mu
+	}
+	return &sync.Mutex{}
+}
+
+type drainWaitKey struct{}
+
+// Makes the searches run with ctx add the time the left side of a
+// bidirectional search idles to end a tier to *wait, see leftDrainTimeout
+func withDrainWait(ctx context.Context, wait *time.Duration) context.Context {
+	return context.WithValue(ctx, drainWaitKey{}, wait)
+}
+
+func addDrainWait(ctx context.Context, d time.Duration) {
+	if wait, ok := ctx.Value(drainWaitKey{}).(*time.Duration); ok {
+		*wait += d
+	}
+}
+
+// Runs a non-live search and returns the exported tree. progress, if not
+// nil, is called with the tier of every step the algorithm reports. The
+// search stops early with ctx's error once ctx is done.
+func runSearch(ctx context.Context, rawElements []Element, opts SearchOptions, progress func(tier int)) (ExportableElement, error) {
+	tree, _, err := searchGraph(ctx, rawElements, opts, progress)
+	return tree, err
+}
+
+// Same as runSearch, also returning the graph as the algorithm left it
+func searchGraph(ctx context.Context, rawElements []Element, opts SearchOptions, progress func(tier int)) (ExportableElement, map[string]*ElementNode, error) {
+	if err := opts.validate(); err != nil {
+		return ExportableElement{}, nil, err
+	}
+	rawElements, err := applyCostOptions(rawElements, opts)
+	if err != nil {
+		return ExportableElement{}, nil, err
+	}
+	elementMap, allRecipes := buildGraph(rawElements)
+	root, exists := elementMap[opts.Element]
+	if !exists {
+		return ExportableElement{}, nil, errElementNotFound
+	}
+	trees := newTreeCollector(elementMap)
+
+	var depthChan chan int
+	var progressDone chan struct{}
+	if progress != nil {
+		depthChan = make(chan int)
+		progressDone = make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			for tier := range depthChan {
+				progress(tier)
+			}
+		}()
+	}
+
+	stats := runAlgorithm(ctx, root, elementMap, allRecipes, rawElements, opts, depthChan)
+	if progressDone != nil {
+		<-progressDone
+	}
+	if err := ctx.Err(); err != nil {
+		return ExportableElement{}, nil, err
+	}
+	tree := trees.collect(root, opts.RecipeAmount, opts.Diverse)
+	if stats != nil {
+		tree.Meta["search"] = stats
+	}
+	if opts.Algorithm == "AStar" || len(opts.Costs) > 0 || len(opts.Owned) > 0 || hasCosts(rawElements) {
+		tree.Meta["costs"] = annotateCosts(&tree, elementMap)
+	}
+	return tree, elementMap, nil
+}
+
+// Runs the algorithm of opts from root on a fresh graph, sending the tiers
+// it reports to depthChan when not nil and closing it. Every algorithm
+// stops once ctx is done. Returns the stats of a best-first search, nil
+// for the other algorithms.
+func runAlgorithm(ctx context.Context, root *ElementNode, elementMap map[string]*ElementNode, allRecipes []*RecipeNode, rawElements []Element, opts SearchOptions, depthChan chan int) *astarStats {
+	out := searchLog(ctx)
+	var stats *astarStats
+	val := opts.RecipeAmount
+	switch opts.Algorithm {
+	case "DFS":
+		fmt.Fprintln(out, "Starting DFS for element:", opts.Element)
+		wg := &sync.WaitGroup{}
+		DFS_Multiple(root, wg, elementMap, depthChan, newDFSSearch(ctx, val))
+		wg.Wait()
+		if depthChan != nil {
+			close(depthChan)
+		}
+
+	case "BFS":
+		fmt.Fprintln(out, "Starting BFS for element:", opts.Element)
+		// bfs closes depthChan itself
+		bfs(ctx, root, elementMap, allRecipes, val, depthChan)
+
+	case "AStar":
+		fmt.Fprintln(out, "Starting AStar for element:", opts.Element)
+		result, _ := astar(ctx, root, elementMap, opts.Heuristic, opts.Weight)
+		stats = &result
+		// AStar reports no tiers
+		if depthChan != nil {
+			close(depthChan)
+		}
+
+	case "IDDFS":
+		fmt.Fprintln(out, "Starting IDDFS for element:", opts.Element)
+		// Reports the depth limit of every iteration
+		var onIteration func(limit int)
+		if depthChan != nil {
+			onIteration = func(limit int) { depthChan <- limit }
+		}
+		iddfs(ctx, root, onIteration)
+		if depthChan != nil {
+			close(depthChan)
+		}
+
+	case "Bidirectional":
+		fmt.Fprintln(out, "Starting Bidirect for element:", opts.Element)
+		basic := []*ElementNode{}
+		for _, name := range baseElements(rawElements) {
+			basic = append(basic, elementMap[name])
+		}
+
+		ctx := withGraphLock(ctx, &sync.Mutex{})
+		wg := &sync.WaitGroup{}
+		done := make(chan struct{})
+		if opts.Right == "DFS" {
+			Bidirect_Right_DFS(root, wg, elementMap, depthChan, done, newDFSSearch(ctx, val))
+		} else {
+			Bidirect_Right_BFS(ctx, root, val, wg, elementMap, allRecipes, depthChan, done)
+		}
+		copyAllRecipes := make([]*RecipeNode, len(allRecipes))
+		copy(copyAllRecipes, allRecipes)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if opts.Left == "BFS" {
+				Bidirect_Left_BFS(ctx, basic, root, elementMap, copyAllRecipes, done)
+			} else {
+				Bidirect_Left_DFS(ctx, basic, root, elementMap, copyAllRecipes, done)
+			}
+		}()
+		wg.Wait()
+		// The right side is not part of wg when it runs BFS
+		<-done
+		if depthChan != nil && opts.Right == "DFS" {
+			close(depthChan)
+		}
+		fmt.Fprintln(out, "[MAIN] completed")
+	}
+	return stats
+}
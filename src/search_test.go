@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+)
+
+// Small random graph with defects
+func fuzzGraphOptions(rng *rand.Rand) generatorOptions {
+	opts := generatorOptions{
+		Base:           1 + rng.IntN(4),
+		Tiers:          1 + rng.IntN(6),
+		Recipes:        1 + rng.IntN(4),
+		MinIngredients: 1 + rng.IntN(2),
+		Cycles:         rng.IntN(4),
+		Dangling:       rng.IntN(4),
+		Seed:           rng.Int64(),
+	}
+	opts.MaxIngredients = opts.MinIngredients + rng.IntN(3)
+	opts.Elements = opts.Base + opts.Tiers + rng.IntN(30)
+	return opts
+}
+
+// Runs one algorithm on a small random graph and verifies the result
+func FuzzSearch(f *testing.F) {
+	for seed := uint64(0); seed < 8; seed++ {
+		f.Add(seed, uint8(seed), uint8(seed*7), uint8(seed%4))
+	}
+	f.Fuzz(func(t *testing.T, seed uint64, algorithm, element, amount uint8) {
+		opts := fuzzGraphOptions(rand.New(rand.NewPCG(seed, 0)))
+		elements, err := generateElements(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		search := benchCases[int(algorithm)%len(benchCases)]
+		search.Element = elements[int(element)%len(elements)].Name
+		search.RecipeAmount = 1 + int(amount)%4
+
+		var tree ExportableElement
+		var graph map[string]*ElementNode
+		tree, graph, err = searchGraph(quietContext(false), elements, search, nil)
+		if err != nil {
+			t.Fatalf("%+v %s: %v", opts, benchLabel(search), err)
+		}
+		violations := newTreeVerifier(elements).verify(tree)
+		elementMap, _ := buildGraph(elements)
+		available := newTreeCounter(elementMap).countName(search.Element)
+		violations = append(violations, verifyTreeCount(tree, available, search.RecipeAmount)...)
+		violations = append(violations, verifyGraph(graph[search.Element])...)
+		for _, v := range violations {
+			t.Errorf("%+v %s %s n=%d: %s", opts, benchLabel(search), search.Element, search.RecipeAmount, v)
+		}
+	})
+}
+
+// Draws trees of a random element of a small random graph and verifies
+// them, an element without trees must be refused
+func FuzzSample(f *testing.F) {
+	for seed := uint64(0); seed < 8; seed++ {
+		f.Add(seed, uint8(seed*5), uint8(seed), seed%2 == 0)
+	}
+	f.Fuzz(func(t *testing.T, seed uint64, element, amount uint8, weighted bool) {
+		opts := fuzzGraphOptions(rand.New(rand.NewPCG(seed, 0)))
+		elements, err := generateElements(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sample := sampleOptions{
+			Element: elements[int(element)%len(elements)].Name,
+			Amount:  1 + int(amount)%20,
+			Seed:    int64(seed >> 11),
+			Mode:    "uniform",
+		}
+		if weighted {
+			sample.Mode = "weighted"
+		}
+
+		tree, err := sampleTrees(elements, sample)
+		elementMap, _ := buildGraph(elements)
+		available := newTreeCounter(elementMap).countName(sample.Element)
+		if available.Sign() == 0 {
+			if err == nil {
+				t.Errorf("sampled %d trees of an element without trees", len(tree.Children))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range newTreeVerifier(elements).verify(tree) {
+			t.Errorf("%+v %+v: %s", opts, sample, v)
+		}
+		if !elementMap[sample.Element].IsBase && len(tree.Children) != sample.Amount {
+			t.Errorf("sampled %d trees, expected %d", len(tree.Children), sample.Amount)
+		}
+		if distinct := tree.Meta["distinct"].(int); big.NewInt(int64(distinct)).Cmp(available) > 0 {
+			t.Errorf("%d distinct trees of %s available", distinct, available)
+		}
+	})
+}
+
+// Searches cancelled at their first step stop early with the context's
+// error. The cases report tiers while they search, so a stopped search
+// reports fewer steps than a finished one.
+func TestSearchStopsWhenCancelled(t *testing.T) {
+	elements := testElements(t, benchOptions)
+	target := elements[len(elements)-1].Name
+	cases := []SearchOptions{
+		{Algorithm: "DFS"},
+		{Algorithm: "BFS"},
+		{Algorithm: "IDDFS"},
+		{Algorithm: "Bidirectional", Left: "BFS", Right: "BFS"},
+		{Algorithm: "Bidirectional", Left: "BFS", Right: "DFS"},
+	}
+	for _, c := range cases {
+		opts := c
+		opts.Element = target
+		opts.RecipeAmount = 50
+
+		full := 0
+		if _, err := runSearch(quietContext(false), elements, opts, func(int) { full++ }); err != nil {
+			t.Fatalf("%s: %v", benchLabel(c), err)
+		}
+
+		ctx, cancel := context.WithCancel(quietContext(false))
+		steps := 0
+		_, err := runSearch(ctx, elements, opts, func(int) {
+			steps++
+			cancel()
+		})
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: %v, want %v", benchLabel(c), err, context.Canceled)
+		}
+		if full < 2 || steps >= full {
+			t.Errorf("%s reported %d steps once cancelled, %d when finished", benchLabel(c), steps, full)
+		}
+	}
+}
+
+// AStar reports no tiers, a cancelled search expands no element
+func TestAStarStopsWhenCancelled(t *testing.T) {
+	elements := testElements(t, benchOptions)
+	target := elements[len(elements)-1].Name
+
+	elementMap, _ := buildGraph(elements)
+	stats, found := astar(quietContext(false), elementMap[target], elementMap, "height", 1)
+	if !found || stats.Expanded == 0 {
+		t.Fatalf("finished search found %v after %d expansions", found, stats.Expanded)
+	}
+
+	ctx, cancel := context.WithCancel(quietContext(false))
+	cancel()
+	elementMap, _ = buildGraph(elements)
+	stats, found = astar(ctx, elementMap[target], elementMap, "height", 1)
+	if found || stats.Expanded != 0 {
+		t.Errorf("cancelled search found %v after %d expansions", found, stats.Expanded)
+	}
+}
+
+// Owning O makes the tree of Z through N two crafts, while the tier of N
+// claims five. The tier heuristic would settle for the four crafts
+// through P, so AStar falls back to the zero heuristic.
+func TestAStarTierWithOwnedElements(t *testing.T) {
+	elements := []Element{
+		{Name: "A", Base: true},
+		{Name: "B", Base: true},
+		{Name: "R", Tier: 1, Recipes: [][]string{{"A", "B"}}},
+		{Name: "Q", Tier: 2, Recipes: [][]string{{"R", "A"}}},
+		{Name: "P", Tier: 3, Recipes: [][]string{{"Q", "A"}}},
+		{Name: "O", Tier: 4, Recipes: [][]string{{"P", "A"}}},
+		{Name: "N", Tier: 5, Recipes: [][]string{{"O", "A"}}},
+		{Name: "Z", Tier: 6, Recipes: [][]string{{"N", "A"}, {"P", "A"}}},
+	}
+	opts := SearchOptions{Element: "Z", Algorithm: "AStar", Heuristic: "tier", RecipeAmount: 1, Owned: []string{"O"}}
+	tree, err := runSearch(quietContext(false), elements, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if costs := tree.Meta["costs"].([]treeCost); costs[0].Total != 2 {
+		t.Errorf("first tree costs %g, the lowest is 2", costs[0].Total)
+	}
+	if stats := tree.Meta["search"].(*astarStats); stats.Heuristic != "zero" {
+		t.Errorf("searched with the %s heuristic, want zero", stats.Heuristic)
+	}
+
+	opts.Owned = nil
+	tree, err = runSearch(quietContext(false), elements, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := tree.Meta["search"].(*astarStats); stats.Heuristic != "tier" {
+		t.Errorf("searched with the %s heuristic without owned elements, want tier", stats.Heuristic)
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
-	"sync"
-	"sync/atomic"
+	"strings"
 	"time"
 )
 
@@ -15,7 +16,7 @@ func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -26,354 +27,437 @@ func withCORS(next http.Handler) http.Handler {
 	})
 }
 
-func addRouteWithCORS(path string, handlerFunc http.HandlerFunc) {
-	http.Handle(path, withCORS(handlerFunc))
+func addRouteWithCORS(mux *http.ServeMux, path string, handlerFunc http.HandlerFunc) {
+	mux.Handle(path, withCORS(withRecover(handlerFunc)))
 }
 
-func serve(jsonBytes []byte) {
-	var rawElements []Element
-	err := json.Unmarshal(jsonBytes, &rawElements)
-	if err != nil {
-		panic(err)
+// Answers a panicking handler with a JSON 500 instead of dropping the
+// connection. Streams that already started only get the log line.
+func withRecover(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				fmt.Println("Panic serving", r.URL.Path+":", err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+		}()
+		next(w, r)
 	}
+}
 
-	addRouteWithCORS("/live-DFS/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
+// Query parameters shared by the search and live routes
+type searchParams struct {
+	Element      string
+	RecipeAmount int
+	// Milliseconds between live updates, 0 when not given
+	Delay int
+	// Best-first search heuristic and its weight, empty and 0 for defaults
+	Heuristic string
+	Weight    float64
+	Costs     map[string]float64
+	Owned     []string
+	Diverse   bool
+}
 
-		recipeAmount := r.URL.Query().Get("recipeAmount")
-		delay := r.URL.Query().Get("delay")
-		val2, err := strconv.Atoi(delay)
-		if err != nil {
-			http.Error(w, "Invalid delay value", http.StatusBadRequest)
-			return
+// Reads the element from the path after prefix, recipeAmount and delay
+func parseSearchParams(r *http.Request, prefix string) (searchParams, error) {
+	var params searchParams
+	elmtName, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok || elmtName == "" {
+		return params, fmt.Errorf("element name is required")
+	}
+	params.Element = elmtName
+	query := r.URL.Query()
+	val, err := strconv.Atoi(query.Get("recipeAmount"))
+	if err != nil || val < 1 || val > maxRecipeAmount {
+		return params, fmt.Errorf("invalid recipe amount %q, expected 1 to %d", query.Get("recipeAmount"), maxRecipeAmount)
+	}
+	params.RecipeAmount = val
+	if d := query.Get("delay"); d != "" {
+		delay, err := strconv.Atoi(d)
+		if err != nil || delay < 0 {
+			return params, fmt.Errorf("invalid delay value %q", d)
 		}
-		fmt.Println("Delay value:", val2)
-		val, err := strconv.Atoi(recipeAmount)
-		if err != nil {
-			http.Error(w, "Invalid recipe amount", http.StatusBadRequest)
-			return
+		params.Delay = delay
+	}
+	params.Heuristic = query.Get("heuristic")
+	if _, ok := heuristics[params.Heuristic]; params.Heuristic != "" && !ok {
+		return params, fmt.Errorf("unknown heuristic %q, expected one of %s", params.Heuristic, strings.Join(heuristicNames(), ", "))
+	}
+	if w := query.Get("weight"); w != "" {
+		weight, err := strconv.ParseFloat(w, 64)
+		if err != nil || !(weight >= 1 && weight <= maxWeight) {
+			return params, fmt.Errorf("invalid weight %q, expected 1 to %g", w, float64(maxWeight))
 		}
-		atomic.StoreInt32(&recipeLeft, int32(val-1))
-		sem = make(chan struct{}, val-1)
-		fmt.Println("Recipe left set to:", recipeLeft)
-
-		fmt.Println("Starting live DFS stream...")
-
-		elmtName := r.URL.Path[len("/live-DFS/"):]
-		if elmtName == "" {
-			http.Error(w, "Element name is required", http.StatusBadRequest)
-			return
+		params.Weight = weight
+	}
+	if params.Costs, err = parseCosts(query.Get("cost")); err != nil {
+		return params, err
+	}
+	params.Owned = splitList(query.Get("owned"))
+	if d := query.Get("diverse"); d != "" {
+		diverse, err := strconv.ParseBool(d)
+		if err != nil {
+			return params, fmt.Errorf("invalid diverse value %q, expected true or false", d)
 		}
-		fmt.Println("Starting DFS for element:", elmtName)
-		elementMap := make(map[string]*ElementNode)
-		for _, el := range rawElements {
-			elementMap[el.Name] = &ElementNode{
-				Name:     el.Name,
-				ImgSrc:   el.ImgSrc,
-				Tier:     el.Tier,
-				Children: []*RecipeNode{},
-			}
+		if diverse && params.RecipeAmount > maxDiverseAmount {
+			return params, fmt.Errorf("invalid recipe amount %d, expected at most %d for diverse results", params.RecipeAmount, maxDiverseAmount)
 		}
-		for _, el := range rawElements {
-			for _, r := range el.Recipes {
-				ing1 := elementMap[r[0]]
-				ing2 := elementMap[r[1]]
-				if ing1 == nil || ing2 == nil {
-					continue
-				}
-				recipe := RecipeNode{
-					Result:      el.Name,
-					Ingredient1: ing1,
-					Ingredient2: ing2,
-				}
-				elementMap[el.Name].Children = append(elementMap[el.Name].Children, &recipe)
-			}
-		}
-		root := elementMap[elmtName]
-		wg := &sync.WaitGroup{}
-		depthChan := make(chan int)
-		barrier := &sync.WaitGroup{}
-
-		barrier.Add(1)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			DFS_Multiple(root, wg, elementMap, depthChan, barrier)
-		}()
+		params.Diverse = diverse
+	}
+	return params, nil
+}
 
-		go func() {
-			wg.Wait()
-			fmt.Println("DFS completed")
-			close(depthChan)
-		}()
+// Elements with the costs and owned elements of the request, as searches
+// and the live routes see them
+func (params searchParams) elements(rawElements []Element) ([]Element, error) {
+	return applyCostOptions(rawElements, SearchOptions{Costs: params.Costs, Owned: params.Owned})
+}
 
-		for {
-			if _, ok := <-depthChan; !ok {
-				break
-			}
-			barrier.Add(1)
-			time.Sleep(time.Duration(val2) * time.Millisecond) // delay
-			barrier.Done()
-			barrier.Wait()
+// Builds a fresh graph since every search mutates its nodes. Ingredients
+// are sorted by name and repeated recipes of an element dropped, keeping
+// the cheapest, so counting, sampling and collecting see the same recipes.
+func buildGraph(rawElements []Element) (map[string]*ElementNode, []*RecipeNode) {
+	elementMap := make(map[string]*ElementNode)
+	var allRecipes []*RecipeNode
+
+	for _, el := range rawElements {
+		node := &ElementNode{
+			Name:     el.Name,
+			ImgSrc:   el.ImgSrc,
+			Tier:     el.Tier,
+			IsBase:   el.Base,
+			Cost:     el.leafCost(),
+			Children: []*RecipeNode{},
+		}
+		if el.Unlock != nil {
+			node.UnlockAfter = el.Unlock.Discoveries
+		}
+		elementMap[el.Name] = node
+	}
 
-			exportList := ExportableElement{
-				Name:       root.Name,
-				Attributes: map[string]string{"Type": "element", "Side": "Right"},
-				Children:   make([]ExportableRecipe, 0, len(root.Children)),
+	for _, el := range rawElements {
+		seen := make(map[string]*RecipeNode)
+	recipes:
+		for i, r := range el.Recipes {
+			recipe := &RecipeNode{Result: el.Name, Cost: el.recipeCost(i)}
+			for _, name := range r {
+				ing := elementMap[name]
+				if ing == nil {
+					continue recipes
+				}
+				recipe.Ingredients = append(recipe.Ingredients, ing)
 			}
-			visitedExport := make(map[*ElementNode]*ExportableElement)
-			ToExportableElement(root, &exportList, visitedExport)
-			// Write to file
-			payload := map[string]any{
-				"depth": exportList, // or "data": exportList
+			if len(recipe.Ingredients) == 0 {
+				continue
 			}
-			wrapped, err := json.Marshal(payload)
-			if err != nil {
-				panic(err)
+			sort.Slice(recipe.Ingredients, func(i, j int) bool {
+				return recipe.Ingredients[i].Name < recipe.Ingredients[j].Name
+			})
+			key := recipe.String()
+			if same, ok := seen[key]; ok {
+				same.Cost = min(same.Cost, recipe.Cost)
+				continue
 			}
-			fmt.Fprintf(w, "data: %s\n\n", wrapped)
-			w.(http.Flusher).Flush()
-			time.Sleep(time.Duration(val2) * time.Millisecond)
+			seen[key] = recipe
+			allRecipes = append(allRecipes, recipe)
+			elementMap[el.Name].Children = append(elementMap[el.Name].Children, recipe)
 		}
-		finalExport := ExportableElement{
-			Name:       root.Name,
-			Attributes: map[string]string{"Type": "element", "Side": "Right"},
-			Children:   make([]ExportableRecipe, 0, len(root.Children)),
-		}
-		visitedExport := make(map[*ElementNode]*ExportableElement)
-		ToExportableElement(root, &finalExport, visitedExport)
+	}
+	return elementMap, allRecipes
+}
 
-		finalPayload := map[string]any{
-			"depth": finalExport,
+func exportTree(root *ElementNode) ExportableElement {
+	exportList := ExportableElement{
+		Name:       root.Name,
+		Attributes: map[string]string{"Type": "element", "Side": "Right"},
+		Children:   make([]ExportableRecipe, 0, len(root.Children)),
+	}
+	visitedExport := make(map[*ElementNode]*ExportableElement)
+	ToExportableElement(root, &exportList, visitedExport)
+	return exportList
+}
+
+// Handler shared by /DFS/, /BFS/ and /Bidirectional/
+func searchHandler(registry *datasetRegistry, cache *resultCache, algorithm string) http.HandlerFunc {
+	prefix := "/" + algorithm + "/"
+	return func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
 		}
-		finalWrapped, err := json.Marshal(finalPayload)
+		params, err := parseSearchParams(r, prefix)
 		if err != nil {
-			panic(err)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
 		}
-		fmt.Fprintf(w, "data: %s\n\n", finalWrapped)
-		fmt.Println("Final payload sent.")
-		w.(http.Flusher).Flush()
-	})
-
-	addRouteWithCORS("/DFS/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		elmtName := r.URL.Path[len("/DFS/"):]
-		query := r.URL.Query().Get("recipes")
-		live := r.URL.Query().Get("live")
-		recipeAmount := r.URL.Query().Get("recipeAmount")
-		fmt.Println("Query parameter:", query)
-		fmt.Println("Live parameter:", live)
-		fmt.Println("Recipe amount parameter:", recipeAmount)
-		val, err := strconv.Atoi(recipeAmount)
-		if err != nil {
-			http.Error(w, "Invalid recipe amount", http.StatusBadRequest)
+		fmt.Println("Recipe amount parameter:", params.RecipeAmount)
+
+		opts := SearchOptions{
+			Dataset:      ds.Name,
+			Element:      params.Element,
+			Algorithm:    algorithm,
+			RecipeAmount: params.RecipeAmount,
+			Left:         r.URL.Query().Get("left"),
+			Right:        r.URL.Query().Get("right"),
+			NoCache:      r.URL.Query().Get("nocache") == "true",
+			Heuristic:    params.Heuristic,
+			Weight:       params.Weight,
+			Costs:        params.Costs,
+			Owned:        params.Owned,
+			Diverse:      params.Diverse,
+		}
+		exportList, cacheStatus, err := cache.search(r.Context(), ds, opts, nil)
+		w.Header().Set("X-Cache", cacheStatus)
+		if errors.Is(err, errElementNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
 			return
 		}
-		if elmtName == "" {
-			http.Error(w, "Element name is required", http.StatusBadRequest)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-
-		atomic.StoreInt32(&recipeLeft, int32(val-1))
-		sem = make(chan struct{}, val-1)
-		fmt.Println("Recipe left set to:", recipeLeft)
-		fmt.Println("Starting DFS for element:", elmtName)
-		elementMap := make(map[string]*ElementNode)
-
-		for _, el := range rawElements {
-			elementMap[el.Name] = &ElementNode{
-				Name:     el.Name,
-				ImgSrc:   el.ImgSrc,
-				Tier:     el.Tier,
-				Children: []*RecipeNode{},
+		if r.URL.Query().Get("verify") == "true" {
+			// Cached trees are shared, only the root copy gets the meta
+			meta := map[string]any{"verify": verifyMeta(newTreeVerifier(ds.Elements).verify(exportList))}
+			for k, v := range exportList.Meta {
+				meta[k] = v
 			}
+			exportList.Meta = meta
 		}
 
-		for _, el := range rawElements {
-			for _, r := range el.Recipes {
-				ing1 := elementMap[r[0]]
-				ing2 := elementMap[r[1]]
-				if ing1 == nil || ing2 == nil {
-					// fmt.Printf("Skipping invalid recipe for %s: missing ingredient(s) %s or %s\n", el.Name, r[0], r[1])
-					continue
-				}
-				recipe := RecipeNode{
-					Result:      el.Name,
-					Ingredient1: ing1,
-					Ingredient2: ing2,
-				}
-				elementMap[el.Name].Children = append(elementMap[el.Name].Children, &recipe)
-			}
+		jsonOut, err := json.Marshal(exportList)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encode JSON"})
+			return
 		}
+		fmt.Println("Exporting to JSON...")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonOut)
+	}
+}
 
-		// Build tree from user input
-		// root := &ElementNode{Name: elmtName, Tier: elementTier, Children: []*RecipeNode{}}
-		root, exists := elementMap[elmtName]
-		if !exists {
-			http.Error(w, "Element not found", http.StatusNotFound)
+type serverConfig struct {
+	MaxJobs      int
+	JobRetention time.Duration
+	CacheSize    int
+	CacheFile    string
+	BatchLimit   int
+	// Snapshot file to reload from, empty to re-scrape
+	DataFile       string
+	DefaultDataset string
+	// Game scraped for the default dataset when DataFile is empty
+	Game string
+	// Extra datasets by name, each a snapshot file or scrape:<game>
+	Datasets      map[string]string
+	WatchInterval time.Duration
+	// Icons mirrored with the mirror-images command
+	ImageDir string
+	// Starting elements of the default dataset, empty to use the snapshot's
+	Base []string
+	// Use tiers computed from the recipes instead of the stored ones
+	ComputedTiers bool
+	// Bearer token required by /admin routes and dataset uploads, empty
+	// allows everyone
+	AdminToken string
+}
+
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "admin token required"})
 			return
 		}
-		wg := &sync.WaitGroup{}
-		barrier := &sync.WaitGroup{}
-		barrier.Add(1)
+		next(w, r)
+	}
+}
 
-		DFS_Multiple(root, wg, elementMap, nil, barrier)
-		wg.Wait()
+// Like requireAdmin, but lets reads through without the token
+func requireAdminToWrite(token string, next http.HandlerFunc) http.HandlerFunc {
+	guarded := requireAdmin(token, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		guarded(w, r)
+	}
+}
 
-		// Export tree
-		exportList := ExportableElement{
-			Name:       root.Name,
-			Attributes: map[string]string{"Type": "element", "Side": "Right"},
-			Children:   make([]ExportableRecipe, 0, len(root.Children)),
+func loadDatasetSource(name, source string) (*datasetStore, error) {
+	if game, ok := strings.CutPrefix(source, "scrape:"); ok {
+		scraper, ok := scrapers[game]
+		if !ok {
+			return nil, fmt.Errorf("unknown game %q", game)
 		}
-		visitedExport := make(map[*ElementNode]*ExportableElement)
-		ToExportableElement(root, &exportList, visitedExport)
+		jsonBytes, err := convertToJson(scraper())
+		if err != nil {
+			return nil, err
+		}
+		ds, err := parseDataset(name, jsonBytes, nil)
+		if err != nil {
+			return nil, err
+		}
+		store := newDatasetStore(ds, "")
+		store.scraper = scraper
+		return store, nil
+	}
 
-		// Write to file
-		jsonOut, err := json.Marshal(exportList)
+	jsonBytes, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := parseDataset(name, jsonBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newDatasetStore(ds, source), nil
+}
+
+func serve(jsonBytes []byte, cfg serverConfig) {
+	ds, err := parseDataset(cfg.DefaultDataset, jsonBytes, cfg.Base)
+	if err != nil {
+		panic(err)
+	}
+	cache := newResultCache(cfg.CacheSize, cfg.CacheFile)
+	registry := newDatasetRegistry(cfg.DefaultDataset)
+	registry.computedTiers = cfg.ComputedTiers
+	registry.onSwap = append(registry.onSwap, func(old, _ *dataset) { cache.purgeVersion(old.Version) })
+	registry.onRemove = append(registry.onRemove, func(ds *dataset) { cache.purgeVersion(ds.Version) })
+
+	store := newDatasetStore(ds, cfg.DataFile)
+	store.scraper = scrapers[cfg.Game]
+	store.base = cfg.Base
+	registry.add(store)
+	fmt.Printf("Dataset %s version: %s\n", ds.Name, store.load().Version)
+	for name, source := range cfg.Datasets {
+		extra, err := loadDatasetSource(name, source)
 		if err != nil {
-			panic(err)
+			panic(fmt.Errorf("dataset %s: %w", name, err))
 		}
-		fmt.Println("Exporting to JSON...")
-		w.Write(jsonOut)
-	})
+		registry.add(extra)
+		fmt.Printf("Dataset %s version: %s\n", name, extra.load().Version)
+	}
+	go registry.watchSignals()
+	if cfg.WatchInterval > 0 {
+		for _, store := range registry.all() {
+			go store.watchFile(cfg.WatchInterval)
+		}
+	}
 
-	addRouteWithCORS("/BFS/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		elmtName := r.URL.Path[len("/BFS/"):]
-		query := r.URL.Query().Get("recipes")
-		live := r.URL.Query().Get("live")
-		recipeAmount := r.URL.Query().Get("recipeAmount")
-		fmt.Println("Query parameter:", query)
-		fmt.Println("Live parameter:", live)
-		fmt.Println("Recipe amount parameter:", recipeAmount)
-		val, err := strconv.Atoi(recipeAmount)
+	mux := http.NewServeMux()
+	registerRoutes(mux, registry, cache, cfg)
+
+	fmt.Println("Now serving in port 8080...")
+	// Wrap the mux with CORS so all routes (including 404) get CORS headers
+	http.ListenAndServe(":8080", withCORS(mux))
+}
+
+// Every route of the server, also used by the tests
+func registerRoutes(mux *http.ServeMux, registry *datasetRegistry, cache *resultCache, cfg serverConfig) {
+	addRouteWithCORS(mux, "/live-DFS/", func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
+		}
+		params, err := parseSearchParams(r, "/live-DFS/")
 		if err != nil {
-			http.Error(w, "Invalid recipe amount", http.StatusBadRequest)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		if elmtName == "" {
-			http.Error(w, "Element name is required", http.StatusBadRequest)
+		rawElements, err := params.elements(ds.Elements)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		fmt.Println("Starting FS for element:", elmtName)
-		elementMap := make(map[string]*ElementNode)
-		var allRecipes []*RecipeNode
-
-		for _, el := range rawElements {
-			elementMap[el.Name] = &ElementNode{
-				Name:     el.Name,
-				ImgSrc:   el.ImgSrc,
-				Tier:     el.Tier,
-				Children: []*RecipeNode{},
-			}
+		elmtName, val, val2 := params.Element, params.RecipeAmount, params.Delay
+		fmt.Println("Delay value:", val2)
+		elementMap, _ := buildGraph(rawElements)
+		root, exists := elementMap[elmtName]
+		if !exists {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+			return
 		}
+		trees := newTreeCollector(elementMap)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
 
-		for _, el := range rawElements {
-			for _, r := range el.Recipes {
-				ing1 := elementMap[r[0]]
-				ing2 := elementMap[r[1]]
-				if ing1 == nil || ing2 == nil {
-					// fmt.Printf("Skipping invalid recipe for %s: missing ingredient(s) %s or %s\n", el.Name, r[0], r[1])
-					continue
-				}
-				recipe := &RecipeNode{
-					Result:      el.Name,
-					Ingredient1: ing1,
-					Ingredient2: ing2,
-				}
-				allRecipes = append(allRecipes, recipe)
-				elementMap[el.Name].Children = append(elementMap[el.Name].Children, recipe)
+		fmt.Println("Starting live DFS stream...")
+		fmt.Println("Starting DFS for element:", elmtName)
+		// Every step waits until it has been sent and the delay is over
+		search := newLiveDFSSearch(r.Context(), val)
+		search.runLive(root, elementMap)
+		for step := range search.steps {
+			search.mu.Lock()
+			payload := map[string]any{"depth": exportTree(root)}
+			search.mu.Unlock()
+			wrapped, err := json.Marshal(payload)
+			if err != nil {
+				fmt.Println("Error marshalling JSON: ", err)
+				close(step.ack)
+				continue
 			}
+			fmt.Fprintf(w, "data: %s\n\n", wrapped)
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Duration(val2) * time.Millisecond)
+			close(step.ack)
 		}
+		fmt.Println("DFS completed")
+		finalExport := trees.collect(root, val, params.Diverse)
 
-		root := elementMap[elmtName]
-		bfs(root, elementMap, allRecipes, val, nil)
-
-		// Export tree
-		exportList := ExportableElement{
-			Name:       root.Name,
-			Attributes: map[string]string{"Type": "element", "Side": "Right"},
-			Children:   make([]ExportableRecipe, 0, len(root.Children)),
+		finalPayload := map[string]any{
+			"depth": finalExport,
 		}
-		visitedExport := make(map[*ElementNode]*ExportableElement)
-		ToExportableElement(root, &exportList, visitedExport)
-
-		// Write to file
-		jsonOut, err := json.Marshal(exportList)
+		finalWrapped, err := json.Marshal(finalPayload)
 		if err != nil {
-			panic(err)
+			fmt.Println("Error marshalling JSON: ", err)
+			return
 		}
-		fmt.Println("Exporting to JSON...")
-		w.Write(jsonOut)
+		fmt.Fprintf(w, "data: %s\n\n", finalWrapped)
+		fmt.Println("Final payload sent.")
+		w.(http.Flusher).Flush()
 	})
 
-	addRouteWithCORS("/live-BFS/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("run")
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
+	addRouteWithCORS(mux, "/DFS/", searchHandler(registry, cache, "DFS"))
 
-		recipeAmount := r.URL.Query().Get("recipeAmount")
-		delay := r.URL.Query().Get("delay")
-		val, err := strconv.Atoi(recipeAmount)
-		if err != nil {
-			http.Error(w, "Invalid recipe amount", http.StatusBadRequest)
+	addRouteWithCORS(mux, "/BFS/", searchHandler(registry, cache, "BFS"))
+
+	addRouteWithCORS(mux, "/live-BFS/", func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
 			return
 		}
-		val2, err := strconv.Atoi(delay)
+		params, err := parseSearchParams(r, "/live-BFS/")
 		if err != nil {
-			http.Error(w, "Invalid delay value", http.StatusBadRequest)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		atomic.StoreInt32(&recipeLeft, int32(val-1))
-
-		fmt.Println("Starting live BFS stream...")
-
-		elmtName := r.URL.Path[len("/live-BFS/"):]
-		if elmtName == "" {
-			http.Error(w, "Element name is required", http.StatusBadRequest)
+		rawElements, err := params.elements(ds.Elements)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		elmtName, val, val2 := params.Element, params.RecipeAmount, params.Delay
+		elementMap, allRecipes := buildGraph(rawElements)
 
-		elementMap := make(map[string]*ElementNode)
-		var allRecipes []*RecipeNode
-
-		for _, el := range rawElements {
-			elementMap[el.Name] = &ElementNode{
-				Name:     el.Name,
-				ImgSrc:   el.ImgSrc,
-				Tier:     el.Tier,
-				Children: []*RecipeNode{},
-			}
-		}
-
-		for _, el := range rawElements {
-			for _, r := range el.Recipes {
-				ing1 := elementMap[r[0]]
-				ing2 := elementMap[r[1]]
-				if ing1 == nil || ing2 == nil {
-					// fmt.Printf("Skipping invalid recipe for %s: missing ingredient(s) %s or %s\n", el.Name, r[0], r[1])
-					continue
-				}
-				recipe := &RecipeNode{
-					Result:      el.Name,
-					Ingredient1: ing1,
-					Ingredient2: ing2,
-				}
-				allRecipes = append(allRecipes, recipe)
-				elementMap[el.Name].Children = append(elementMap[el.Name].Children, recipe)
-			}
+		// root := &ElementNode{Name: elmtName, Tier: 1, Children: []*RecipeNode{}}
+		root, exists := elementMap[elmtName]
+		if !exists {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+			return
 		}
+		trees := newTreeCollector(elementMap)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
 
-		// root := &ElementNode{Name: elmtName, Tier: 1, Children: []*RecipeNode{}}
-		root := elementMap[elmtName]
+		fmt.Println("Starting live BFS stream...")
 		ch := make(chan int)
-		barrier := &sync.WaitGroup{}
-		barrier.Add(1)
-		go bfs(root, elementMap, allRecipes, val, ch)
+		go bfs(r.Context(), root, elementMap, allRecipes, val, ch)
 
 		for _ = range ch {
 			exportList := ExportableElement{
@@ -398,164 +482,90 @@ func serve(jsonBytes []byte) {
 		}
 		// visited := make(map[*ElementNode]*ExportableElement)
 		// finalExport := ToExportableElement3(root, visited)
-		finalExport := ExportableElement{
-			Name:       root.Name,
-			Attributes: map[string]string{"Type": "element", "Side": "Right"},
-			Children:   make([]ExportableRecipe, 0, len(root.Children)),
-		}
-		visitedExport := make(map[*ElementNode]*ExportableElement)
-		ToExportableElement(root, &finalExport, visitedExport)
+		finalExport := trees.collect(root, val, params.Diverse)
 
 		finalPayload := map[string]any{
 			"depth": finalExport,
 		}
 		finalWrapped, err := json.Marshal(finalPayload)
 		if err != nil {
-			panic(err)
+			fmt.Println("Error marshalling JSON: ", err)
+			return
 		}
 		fmt.Fprintf(w, "data: %s\n\n", finalWrapped)
 		w.(http.Flusher).Flush()
 	})
 
-	addRouteWithCORS("/Bidirectional/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		elmtName := r.URL.Path[len("/Bidirectional/"):]
-		query := r.URL.Query().Get("recipes")
-		live := r.URL.Query().Get("live")
-		recipeAmount := r.URL.Query().Get("recipeAmount")
-		left := r.URL.Query().Get("left")
-		right := r.URL.Query().Get("right")
-		fmt.Println("Right parameter:", right)
-		fmt.Println("Left parameter:", left)
-
-		fmt.Println("Query parameter:", query)
-		fmt.Println("Live parameter:", live)
-		val, err := strconv.Atoi(recipeAmount)
+	addRouteWithCORS(mux, "/IDDFS/", searchHandler(registry, cache, "IDDFS"))
+	addRouteWithCORS(mux, "/AStar/", searchHandler(registry, cache, "AStar"))
+
+	// One event per depth limit, then the final trees
+	addRouteWithCORS(mux, "/live-IDDFS/", func(w http.ResponseWriter, r *http.Request) {
+		ds, ok := registry.resolve(w, r)
+		if !ok {
+			return
+		}
+		params, err := parseSearchParams(r, "/live-IDDFS/")
 		if err != nil {
-			http.Error(w, "Invalid recipe amount", http.StatusBadRequest)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		atomic.StoreInt32(&recipeLeft, int32(val-1))
-		sem = make(chan struct{}, val-1)
-		fmt.Println("Recipe left set to:", recipeLeft)
-		if elmtName == "" {
-			http.Error(w, "Element name is required", http.StatusBadRequest)
+		rawElements, err := params.elements(ds.Elements)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
-		fmt.Println("Starting Bidirect for element:", elmtName)
-		elementMap := make(map[string]*ElementNode)
-		var allRecipes []*RecipeNode
-
-		for _, el := range rawElements {
-			elementMap[el.Name] = &ElementNode{
-				Name:     el.Name,
-				ImgSrc:   el.ImgSrc,
-				Tier:     el.Tier,
-				Children: []*RecipeNode{},
-			}
+		elementMap, _ := buildGraph(rawElements)
+		root, exists := elementMap[params.Element]
+		if !exists {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "element not found"})
+			return
 		}
+		trees := newTreeCollector(elementMap)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
 
-		for _, el := range rawElements {
-			for _, r := range el.Recipes {
-				ing1 := elementMap[r[0]]
-				ing2 := elementMap[r[1]]
-				if ing1 == nil || ing2 == nil {
-					// fmt.Printf("Skipping invalid recipe for %s: missing ingredient(s) %s or %s\n", el.Name, r[0], r[1])
-					continue
-				}
-				recipe := &RecipeNode{
-					Result:      el.Name,
-					Ingredient1: ing1,
-					Ingredient2: ing2,
-				}
-				allRecipes = append(allRecipes, recipe)
-				elementMap[el.Name].Children = append(elementMap[el.Name].Children, recipe)
+		send := func(payload map[string]any) {
+			wrapped, err := json.Marshal(payload)
+			if err != nil {
+				fmt.Println("Error marshalling JSON: ", err)
+				return
 			}
+			fmt.Fprintf(w, "data: %s\n\n", wrapped)
+			w.(http.Flusher).Flush()
 		}
+		fmt.Println("Starting live IDDFS stream for element:", params.Element)
+		iddfs(r.Context(), root, func(limit int) {
+			send(map[string]any{"depth": exportTree(root), "iteration": limit})
+			time.Sleep(time.Duration(params.Delay) * time.Millisecond)
+		})
+		send(map[string]any{"depth": trees.collect(root, params.RecipeAmount, params.Diverse)})
+		fmt.Println("Final payload sent.")
+	})
 
-		// root := &ElementNode{Name: elmtName, Tier: 1, Children: []*RecipeNode{}}
-		root := elementMap[elmtName]
-		wg := &sync.WaitGroup{}
-		basic := []*ElementNode{}
-		basic = append(basic, elementMap["Earth"])
-		basic = append(basic, elementMap["Fire"])
-		basic = append(basic, elementMap["Air"])
-		basic = append(basic, elementMap["Water"])
-		done := make(chan struct{})
-
-		if right == "DFS" {
-			Bidirect_Right_DFS(root, wg, elementMap, nil, done)
-		} else {
-			Bidirect_Right_BFS(root, val, wg, elementMap, allRecipes, nil, done)
-		}
-		copyAllRecipes := make([]*RecipeNode, len(allRecipes))
-		copy(copyAllRecipes, allRecipes)
-		if left == "BFS" {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				Bidirect_Left_BFS(basic, root, elementMap, copyAllRecipes, done)
-				fmt.Println("[BFS Left] Done")
-			}()
-		} else {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				Bidirect_Left_DFS(basic, root, elementMap, copyAllRecipes, done)
-				fmt.Println("[DFS Left] Done")
-			}()
-		}
-		wg.Wait()
-		fmt.Println("[MAIN] completed")
-
-		exportList := ExportableElement{
-			Name:       root.Name,
-			Attributes: map[string]string{"Type": "element", "Side": "Right"},
-			Children:   make([]ExportableRecipe, 0, len(root.Children)),
-		}
-		exportList.Children = make([]ExportableRecipe, 0, len(root.Children))
-
-		visitedExport := make(map[*ElementNode]*ExportableElement)
-		ToExportableElement(root, &exportList, visitedExport)
+	addRouteWithCORS(mux, "/Bidirectional/", searchHandler(registry, cache, "Bidirectional"))
+	addRouteWithCORS(mux, "/sample/", sampleHandler(registry))
 
-		jsonOut, err := json.Marshal(exportList)
-		if err != nil {
-			panic(err)
-		}
-		fmt.Println("Exporting to JSON...")
-		w.Write(jsonOut)
-	})
+	addRouteWithCORS(mux, "/ws/", liveWebSocket(registry).ServeHTTP)
 
-	addRouteWithCORS("/image", func(w http.ResponseWriter, r *http.Request) {
-		// Shuffle rawElements
-		rand.Seed(time.Now().UnixNano())
-		shuffled := make([]Element, len(rawElements))
-		copy(shuffled, rawElements)
-		rand.Shuffle(len(shuffled), func(i, j int) {
-			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-		})
+	addRouteWithCORS(mux, "/cache", requireAdminToWrite(cfg.AdminToken, cache.handler))
+	addRouteWithCORS(mux, "/admin/reload", requireAdmin(cfg.AdminToken, registry.reloadHandler))
+	addRouteWithCORS(mux, "/datasets", registry.listHandler)
+	addRouteWithCORS(mux, "/datasets/", requireAdminToWrite(cfg.AdminToken, registry.packHandler))
+	addRouteWithCORS(mux, "/elements/", registry.elementHandler)
+	addRouteWithCORS(mux, "/export", registry.exportHandler)
+	addRouteWithCORS(mux, "/tiers", registry.tiersHandler)
+	addRouteWithCORS(mux, "/api/images/", imageHandler(&imageStore{dir: cfg.ImageDir}, registry))
+	addRouteWithCORS(mux, "/batch", batchHandler(registry, cache, cfg.BatchLimit))
 
-		// Pick up to 50 elements with non-empty image URLs
-		imageMap := make(map[string]string)
-		count := 0
-		for _, el := range shuffled {
-			if el.ImgSrc != "" {
-				imageMap[el.Name] = el.ImgSrc
-				count++
-			}
-			if count >= 50 {
-				break
-			}
-		}
+	jobs := newJobManager(registry, cache, cfg.MaxJobs, cfg.JobRetention)
+	addRouteWithCORS(mux, "/jobs", jobs.handler)
+	addRouteWithCORS(mux, "/jobs/", jobs.handler)
 
-		// Write JSON response
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(imageMap); err != nil {
-			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
-		}
-	})
+	addRouteWithCORS(mux, "/image", mosaicHandler(registry))
 
-	// addRouteWithCORS("/live-Bidirectional/", func(w http.ResponseWriter, r *http.Request) {
+	// addRouteWithCORS(mux, "/live-Bidirectional/", func(w http.ResponseWriter, r *http.Request) {
 	// 	w.Header().Set("Content-Type", "text/event-stream")
 	// 	w.Header().Set("Cache-Control", "no-cache")
 	// 	w.Header().Set("Connection", "keep-alive")
@@ -696,7 +706,7 @@ func serve(jsonBytes []byte) {
 	// 	w.(http.Flusher).Flush()
 	// })
 
-	addRouteWithCORS(("/example-stream"), func(w http.ResponseWriter, r *http.Request) {
+	addRouteWithCORS(mux, ("/example-stream"), func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
@@ -712,7 +722,7 @@ func serve(jsonBytes []byte) {
 		<-r.Context().Done()
 	})
 
-	addRouteWithCORS("/example-tree-data", func(w http.ResponseWriter, r *http.Request) {
+	addRouteWithCORS(mux, "/example-tree-data", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`[
 {
@@ -849,8 +859,4 @@ func serve(jsonBytes []byte) {
 }
 		]`))
 	})
-
-	fmt.Println("Now serving in port 8080...")
-	// Wrap the default mux with CORS so all routes (including 404) get CORS headers
-	http.ListenAndServe(":8080", withCORS(http.DefaultServeMux))
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Registry holding a generated dataset as its default
+func testRegistry(tb testing.TB) *datasetRegistry {
+	tb.Helper()
+	elements := testElements(tb, generatorOptions{Elements: 30, Base: 4, Tiers: 5, Recipes: 2, MinIngredients: 2, MaxIngredients: 3, Cycles: 2, Dangling: 2, Seed: 1})
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	ds, err := parseDataset("test", jsonBytes, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	registry := newDatasetRegistry("test")
+	registry.add(newDatasetStore(ds, ""))
+	return registry
+}
+
+// Routes of a server over a generated dataset
+func testMux(tb testing.TB, cfg serverConfig) *http.ServeMux {
+	tb.Helper()
+	mux := http.NewServeMux()
+	registerRoutes(mux, testRegistry(tb), newResultCache(64, ""), cfg)
+	return mux
+}
+
+// Listing datasets needs no token, changing them does
+func TestDatasetsAdminToken(t *testing.T) {
+	mux := testMux(t, serverConfig{AdminToken: "secret"})
+	cases := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/datasets/", "", http.StatusOK},
+		{http.MethodGet, "/datasets", "", http.StatusOK},
+		{http.MethodPut, "/datasets/pack", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/datasets/pack", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/datasets/pack", "wrong", http.StatusUnauthorized},
+		{http.MethodDelete, "/datasets/pack", "secret", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s %s with token %q: status %d, want %d", c.method, c.path, c.token, rec.Code, c.want)
+		}
+	}
+}
+
+// Every answer of a search route is a tree or a JSON error
+func FuzzSearchParams(f *testing.F) {
+	mux := testMux(f, serverConfig{})
+	routes := append(append([]string(nil), algorithms...), "sample")
+	f.Add(uint8(0), "T3E1", "recipeAmount=2")
+	f.Add(uint8(1), "T3E1", "recipeAmount=0")
+	f.Add(uint8(2), "Base1", "recipeAmount=99999999999999999999")
+	f.Add(uint8(3), "T5E1", "recipeAmount=3&heuristic=zero&weight=2")
+	f.Add(uint8(4), "T2E1", "recipeAmount=2&left=BFS&right=DFS&verify=true")
+	f.Add(uint8(0), "T4E1", "recipeAmount=2&cost=T1E1:2&owned=T2E1&diverse=true")
+	f.Add(uint8(5), "T4E1", "k=5&seed=1&mode=weighted")
+	f.Add(uint8(1), "%00", "recipeAmount=-1&delay=x&dataset=")
+	f.Fuzz(func(t *testing.T, route uint8, element, query string) {
+		u := &url.URL{Path: "/" + routes[int(route)%len(routes)] + "/" + element, RawQuery: query}
+		rec := httptest.NewRecorder()
+		req := (&http.Request{Method: http.MethodGet, URL: u, Header: http.Header{}}).WithContext(quietContext(false))
+		mux.ServeHTTP(rec, req)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			// The mux redirects paths it cleans
+			if rec.Code == http.StatusMovedPermanently {
+				return
+			}
+			t.Fatalf("status %d with a body that is not JSON: %q", rec.Code, rec.Body.String())
+		}
+		switch rec.Code {
+		case http.StatusOK:
+			if _, ok := body["name"]; !ok {
+				t.Errorf("status 200 without a tree")
+			}
+		case http.StatusBadRequest, http.StatusNotFound:
+			if _, ok := body["error"]; !ok {
+				t.Errorf("status %d without an error message", rec.Code)
+			}
+		default:
+			t.Errorf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+// Events of a server-sent event stream, decoded from JSON
+func readEvents(tb testing.TB, body string) []map[string]any {
+	tb.Helper()
+	var events []map[string]any
+	for _, chunk := range strings.Split(body, "\n\n") {
+		data, ok := strings.CutPrefix(chunk, "data: ")
+		if !ok {
+			continue
+		}
+		var event map[string]any
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			tb.Fatalf("event %q: %v", data, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Live DFS streams every step and the final trees, whatever the number of
+// goroutines the recipe amount allows
+func TestLiveDFSStream(t *testing.T) {
+	mux := testMux(t, serverConfig{})
+	for _, amount := range []int{1, 3, 4, 6} {
+		target := fmt.Sprintf("/live-DFS/T5E1?recipeAmount=%d", amount)
+		req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(quietContext(false))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", target, rec.Code, rec.Body)
+		}
+		events := readEvents(t, rec.Body.String())
+		if len(events) < 2 {
+			t.Fatalf("%s: %d events, want the steps and the final trees", target, len(events))
+		}
+		final, _ := events[len(events)-1]["depth"].(map[string]any)
+		if final["name"] != "T5E1" {
+			t.Errorf("%s: final trees %v", target, final)
+		}
+	}
+}
+
+// The live routes search the graph with the owned elements of the request
+// as leaves, and reject costs and owned elements the dataset lacks
+func TestLiveRoutesCostOptions(t *testing.T) {
+	mux := testMux(t, serverConfig{})
+	for _, route := range []string{"live-DFS", "live-BFS", "live-IDDFS"} {
+		target := "/" + route + "/T4E1?recipeAmount=2&owned=T4E1&cost=Base1:2"
+		req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(quietContext(false))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", target, rec.Code, rec.Body)
+		}
+		events := readEvents(t, rec.Body.String())
+		if len(events) == 0 {
+			t.Fatalf("%s: no events", target)
+		}
+		final, _ := events[len(events)-1]["depth"].(map[string]any)
+		if children, _ := final["children"].([]any); final["name"] != "T4E1" || len(children) != 0 {
+			t.Errorf("%s: owned T4E1 is not a leaf: %v", target, final)
+		}
+
+		for _, query := range []string{"owned=Nope", "cost=Nope:1"} {
+			target := "/" + route + "/T4E1?recipeAmount=2&" + query
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: status %d, want %d", target, rec.Code, http.StatusBadRequest)
+			}
+		}
+	}
+}
+
+// Every route answers from the dataset picked with ?dataset=, the default
+// one without it
+func TestMultipleDatasets(t *testing.T) {
+	registry := testRegistry(t)
+	small, err := parseDataset("small", []byte(`[{"name":"Air","base":true},{"name":"Fire","base":true},{"name":"Smoke","tier":1,"recipes":[["Air","Fire"]]}]`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.add(newDatasetStore(small, ""))
+	mux := http.NewServeMux()
+	registerRoutes(mux, registry, newResultCache(16, ""), serverConfig{})
+
+	cases := []struct {
+		target      string
+		want        int
+		wantDataset string
+	}{
+		{"/BFS/T3E1?recipeAmount=1", http.StatusOK, "test"},
+		{"/BFS/T3E1?recipeAmount=1&dataset=small", http.StatusNotFound, "small"},
+		{"/BFS/Smoke?recipeAmount=1&dataset=small", http.StatusOK, "small"},
+		{"/BFS/Smoke?recipeAmount=1", http.StatusNotFound, "test"},
+		{"/elements/Smoke?dataset=small", http.StatusOK, "small"},
+		{"/export?dataset=small", http.StatusOK, "small"},
+		{"/tiers?dataset=small", http.StatusOK, "small"},
+		{"/BFS/Smoke?recipeAmount=1&dataset=nope", http.StatusNotFound, ""},
+		{"/elements/Smoke?dataset=nope", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.target, nil).WithContext(quietContext(false)))
+		if rec.Code != c.want || rec.Header().Get("X-Dataset") != c.wantDataset {
+			t.Errorf("%s: status %d from %q, want %d from %q", c.target, rec.Code, rec.Header().Get("X-Dataset"), c.want, c.wantDataset)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/datasets", nil))
+	var infos []datasetInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "small" || infos[0].Default || infos[1].Name != "test" || !infos[1].Default {
+		t.Errorf("listed %+v", infos)
+	}
+	if infos[0].Elements != 3 || infos[0].Version != small.Version {
+		t.Errorf("small listed as %+v", infos[0])
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Computes every element's tier as its minimal crafting depth: base
+// elements are tier 0 and a recipe yields one more than its highest
+// ingredient. Elements that cannot be crafted from the base are missing
+// from the result.
+func computeTiers(elements []Element, base []string) map[string]int {
+	tiers := make(map[string]int, len(elements))
+	for _, name := range base {
+		tiers[name] = 0
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, el := range elements {
+		recipes:
+			for _, r := range el.Recipes {
+				if len(r) == 0 {
+					continue
+				}
+				tier := 0
+				for _, ing := range r {
+					t, ok := tiers[ing]
+					if !ok {
+						continue recipes
+					}
+					tier = max(tier, t+1)
+				}
+				if current, ok := tiers[el.Name]; !ok || tier < current {
+					tiers[el.Name] = tier
+					changed = true
+				}
+			}
+		}
+	}
+	return tiers
+}
+
+// Names of the elements marked as starting elements
+func baseElements(elements []Element) []string {
+	var base []string
+	for _, el := range elements {
+		if el.Base {
+			base = append(base, el.Name)
+		}
+	}
+	return base
+}
+
+type tierMismatch struct {
+	Element  string `json:"element"`
+	Scraped  int    `json:"scraped"`
+	Computed int    `json:"computed"`
+}
+
+type tierReport struct {
+	Base        []string       `json:"base"`
+	Checked     int            `json:"checked"`
+	Mismatches  []tierMismatch `json:"mismatches"`
+	Unreachable []string       `json:"unreachable"`
+}
+
+// Compares the tiers stored in the dataset with the computed ones
+func checkTiers(elements []Element, base []string) tierReport {
+	computed := computeTiers(elements, base)
+	report := tierReport{
+		Base:        base,
+		Mismatches:  []tierMismatch{},
+		Unreachable: []string{},
+	}
+	for _, el := range elements {
+		tier, ok := computed[el.Name]
+		if !ok {
+			report.Unreachable = append(report.Unreachable, el.Name)
+			continue
+		}
+		report.Checked++
+		if tier != el.Tier {
+			report.Mismatches = append(report.Mismatches, tierMismatch{
+				Element:  el.Name,
+				Scraped:  el.Tier,
+				Computed: tier,
+			})
+		}
+	}
+	return report
+}
+
+// Returns a copy of the dataset using computed tiers. Elements that cannot
+// be crafted from the base are dropped.
+func (ds *dataset) withComputedTiers() *dataset {
+	base := ds.Base
+	report := checkTiers(ds.Elements, base)
+	fmt.Printf("Dataset %s: %d tiers differ from the computed ones, %d elements unreachable\n",
+		ds.Name, len(report.Mismatches), len(report.Unreachable))
+	computed := computeTiers(ds.Elements, base)
+	elements := make([]Element, 0, len(ds.Elements))
+	for _, el := range ds.Elements {
+		tier, ok := computed[el.Name]
+		if !ok {
+			fmt.Printf("Dataset %s: dropping %s, it cannot be crafted from the base elements\n", ds.Name, el.Name)
+			continue
+		}
+		el.Tier = tier
+		elements = append(elements, el)
+	}
+	return &dataset{
+		Name:     ds.Name,
+		Version:  ds.Version + "-ct",
+		Elements: elements,
+		Base:     base,
+		LoadedAt: ds.LoadedAt,
+		Tiers:    &report,
+	}
+}
+
+// GET /tiers?dataset= reports where stored and computed tiers disagree
+func (reg *datasetRegistry) tiersHandler(w http.ResponseWriter, r *http.Request) {
+	ds, ok := reg.resolve(w, r)
+	if !ok {
+		return
+	}
+	// With -computed-tiers the snapshot keeps the report of the original tiers
+	report := ds.Tiers
+	if report == nil {
+		r := checkTiers(ds.Elements, ds.Base)
+		report = &r
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dataset":        ds.Name,
+		"datasetVersion": ds.Version,
+		"computedTiers":  ds.Tiers != nil,
+		"report":         report,
+	})
+}
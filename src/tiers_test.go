@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Elements of a dataset without tier headings: every tier is 0
+var untieredElements = []Element{
+	{Name: "Air", Base: true},
+	{Name: "Fire", Base: true},
+	{Name: "Smoke", Recipes: [][]string{{"Air", "Fire"}}},
+	// Smoke+Air is deeper than Fire+Fire, the lowest depth wins
+	{Name: "Ash", Recipes: [][]string{{"Smoke", "Air"}, {"Fire", "Fire"}}},
+	{Name: "Cloud", Recipes: [][]string{{"Smoke", "Ash"}}},
+	{Name: "Ghost", Recipes: [][]string{{"Ghost", "Air"}}},
+}
+
+func TestComputeTiers(t *testing.T) {
+	want := map[string]int{"Air": 0, "Fire": 0, "Smoke": 1, "Ash": 1, "Cloud": 2}
+	if got := computeTiers(untieredElements, []string{"Air", "Fire"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("tiers %v, want %v", got, want)
+	}
+
+	report := checkTiers(untieredElements, []string{"Air", "Fire"})
+	if report.Checked != 5 || len(report.Mismatches) != 3 || !reflect.DeepEqual(report.Unreachable, []string{"Ghost"}) {
+		t.Errorf("report %+v", report)
+	}
+}
+
+// With computed tiers, a dataset without tiers can be searched and the
+// elements that cannot be crafted are dropped
+func TestWithComputedTiers(t *testing.T) {
+	ds := &dataset{Name: "test", Version: "v1", Elements: untieredElements, Base: []string{"Air", "Fire"}}
+	computed := ds.withComputedTiers()
+	if computed.Version == ds.Version || computed.Tiers == nil || len(computed.Tiers.Mismatches) != 3 {
+		t.Errorf("version %s, report %+v", computed.Version, computed.Tiers)
+	}
+	if len(computed.Elements) != 5 || ds.Elements[2].Tier != 0 {
+		t.Errorf("%d elements kept, original Smoke tier %d", len(computed.Elements), ds.Elements[2].Tier)
+	}
+
+	opts := SearchOptions{Element: "Cloud", Algorithm: "BFS", RecipeAmount: 1}
+	if tree, err := runSearch(quietContext(false), ds.Elements, opts, nil); err != nil || len(tree.Children) != 0 {
+		t.Errorf("stored tiers: %d trees, error %v, want none", len(tree.Children), err)
+	}
+	for _, c := range benchCases {
+		opts := c
+		opts.Element = "Cloud"
+		opts.RecipeAmount = 1
+		tree, err := runSearch(quietContext(false), computed.Elements, opts, nil)
+		if err != nil || len(tree.Children) != 1 {
+			t.Errorf("%s with computed tiers: %d trees, error %v", benchLabel(c), len(tree.Children), err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// The recipe limit of a search is the number of distinct complete trees it
+// returns. A complete tree crafts every occurrence of an element with one
+// recipe and ends in base elements. Occurrences pick their recipes on their
+// own, so an element used twice may be crafted two ways in one tree, and
+// two trees differ when any occurrence uses another recipe.
+// Every algorithm explores the graph its own way, then the same collector
+// tops the explored recipes up until they hold enough trees and extracts
+// exactly min(limit, available) of them.
+type treeCollector struct {
+	// Counts over every recipe of the dataset, taken before the search
+	// replaces the children of the nodes it explores
+	full    *treeCounter
+	recipes map[*ElementNode][]*RecipeNode
+}
+
+// Must be called on a fresh graph from buildGraph, before any search
+func newTreeCollector(elementMap map[string]*ElementNode) *treeCollector {
+	c := &treeCollector{
+		full:    newTreeCounter(elementMap),
+		recipes: make(map[*ElementNode][]*RecipeNode, len(elementMap)),
+	}
+	for _, node := range elementMap {
+		c.recipes[node] = append([]*RecipeNode(nil), node.Children...)
+	}
+	for _, node := range elementMap {
+		c.full.count(node)
+	}
+	return c
+}
+
+// A recipe that lowers the tier and whose ingredients all have a tree
+func (c *treeCollector) completable(recipe *RecipeNode, tier int) bool {
+	if !recipe.usableFor(tier) {
+		return false
+	}
+	for _, ing := range recipe.Ingredients {
+		if c.full.count(ing).Sign() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hasRecipe(recipes []*RecipeNode, recipe *RecipeNode) bool {
+	for _, r := range recipes {
+		if r.sameIngredients(recipe) {
+			return true
+		}
+	}
+	return false
+}
+
+// Drops explored recipes that cannot end in base elements and gives every
+// element below node at least one recipe
+func (c *treeCollector) complete(node *ElementNode, seen map[*ElementNode]bool) {
+	if seen[node] {
+		return
+	}
+	seen[node] = true
+	if node.IsBase {
+		node.Children = nil
+		return
+	}
+	var kept []*RecipeNode
+	for _, recipe := range node.Children {
+		if c.completable(recipe, node.Tier) && !hasRecipe(kept, recipe) {
+			kept = append(kept, recipe)
+		}
+	}
+	if len(kept) == 0 {
+		for _, recipe := range c.recipes[node] {
+			if c.completable(recipe, node.Tier) {
+				kept = append(kept, recipe)
+				break
+			}
+		}
+	}
+	node.Children = kept
+	for _, recipe := range kept {
+		for _, ing := range recipe.Ingredients {
+			c.complete(ing, seen)
+		}
+	}
+}
+
+// Adds unexplored recipes, closest to the root first, until the explored
+// graph holds limit trees or every tree of root
+func (c *treeCollector) topUp(root *ElementNode, limit int) {
+	want := big.NewInt(int64(limit))
+	if available := c.full.count(root); available.Cmp(want) < 0 {
+		want = available
+	}
+	for newTreeCounter(nil).count(root).Cmp(want) < 0 {
+		if !c.addRecipe(root) {
+			return
+		}
+	}
+}
+
+func (c *treeCollector) addRecipe(root *ElementNode) bool {
+	queue := []*ElementNode{root}
+	queued := map[*ElementNode]bool{root: true}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if node.IsBase {
+			continue
+		}
+		for _, recipe := range c.recipes[node] {
+			if c.completable(recipe, node.Tier) && !hasRecipe(node.Children, recipe) {
+				node.Children = append(node.Children, recipe)
+				seen := make(map[*ElementNode]bool)
+				for _, ing := range recipe.Ingredients {
+					c.complete(ing, seen)
+				}
+				return true
+			}
+		}
+		for _, recipe := range node.Children {
+			for _, ing := range recipe.Ingredients {
+				if !queued[ing] {
+					queued[ing] = true
+					queue = append(queue, ing)
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Exported node without children, Side and Type as ToExportableElement
+// sets them
+func exportLeaf(node *ElementNode) ExportableElement {
+	attributes := map[string]string{"Type": "element", "Side": "Right"}
+	if node.Left {
+		attributes["Side"] = "Left"
+	}
+	if node.UnlockAfter > 0 {
+		attributes["UnlockAfter"] = strconv.Itoa(node.UnlockAfter)
+	}
+	return ExportableElement{Name: node.Name, ImgSrc: node.ImgSrc, Attributes: attributes}
+}
+
+// Up to limit distinct complete trees of root in the explored graph. Each
+// tree is one recipe child of the returned root, with one recipe for every
+// occurrence of an element below it.
+func extractTrees(root *ElementNode, limit int) ExportableElement {
+	memo := make(map[*ElementNode][]ExportableElement)
+	var trees func(node *ElementNode) []ExportableElement
+	trees = func(node *ElementNode) []ExportableElement {
+		if found, ok := memo[node]; ok {
+			return found
+		}
+		var found []ExportableElement
+		if node.IsBase {
+			found = []ExportableElement{exportLeaf(node)}
+		}
+		for _, recipe := range node.Children {
+			if len(found) >= limit {
+				break
+			}
+			// Every partial combination extends to at least one tree, so
+			// keeping only as many as still fit is enough
+			combos := [][]ExportableElement{nil}
+			for _, ing := range recipe.Ingredients {
+				var next [][]ExportableElement
+				for _, combo := range combos {
+					for _, sub := range trees(ing) {
+						if len(found)+len(next) >= limit {
+							break
+						}
+						next = append(next, append(append([]ExportableElement(nil), combo...), sub))
+					}
+				}
+				combos = next
+			}
+			for _, combo := range combos {
+				tree := exportLeaf(node)
+				tree.Children = []ExportableRecipe{{Attributes: "recipe", Children: combo}}
+				found = append(found, tree)
+			}
+		}
+		memo[node] = found
+		return found
+	}
+
+	result := exportLeaf(root)
+	result.Children = []ExportableRecipe{}
+	if !root.IsBase {
+		for _, tree := range trees(root) {
+			result.Children = append(result.Children, tree.Children[0])
+		}
+	}
+	return result
+}
+
+// Brings the graph a search explored from root to min(limit, available)
+// trees and exports them, the most different ones when diverse is set
+func (c *treeCollector) collect(root *ElementNode, limit int, diverse bool) ExportableElement {
+	if diverse {
+		return c.collectDiverse(root, limit)
+	}
+	c.complete(root, make(map[*ElementNode]bool))
+	c.topUp(root, limit)
+	result := extractTrees(root, limit)
+	result.Meta = map[string]any{
+		"trees":          len(result.Children),
+		"treesAvailable": c.full.count(root).String(),
+	}
+	if root.IsBase {
+		result.Meta["trees"] = 1
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Every algorithm and strategy returns min(limit, available) trees for the
+// same element and limit
+func TestTreeCountSameForEveryAlgorithm(t *testing.T) {
+	elements, err := generateElements(generatorOptions{Elements: 60, Base: 4, Tiers: 8, Recipes: 3, MinIngredients: 2, MaxIngredients: 3, Cycles: 4, Dangling: 4, Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elementMap, _ := buildGraph(elements)
+	counter := newTreeCounter(elementMap)
+	for _, limit := range []int{1, 2, 5, 20} {
+		for _, c := range benchCases {
+			t.Run(fmt.Sprintf("%s/n=%d", benchLabel(c), limit), func(t *testing.T) {
+				for _, el := range elements {
+					// A base element is its own tree and has no recipe child
+					if el.Base {
+						continue
+					}
+					opts := c
+					opts.Element = el.Name
+					opts.RecipeAmount = limit
+					var tree ExportableElement
+					var err error
+					tree, err = runSearch(quietContext(false), elements, opts, nil)
+					if err != nil {
+						t.Fatalf("%s: %v", el.Name, err)
+					}
+					want := big.NewInt(int64(limit))
+					if available := counter.countName(el.Name); available.Cmp(want) < 0 {
+						want = available
+					}
+					if got := big.NewInt(int64(len(tree.Children))); got.Cmp(want) != 0 {
+						t.Errorf("%s: %s trees, want %s", el.Name, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Repeated recipes and recipes listing the same ingredients in another
+// order are one recipe, for the counter and for every algorithm
+func TestRepeatedRecipesCountOnce(t *testing.T) {
+	elements := []Element{
+		{Name: "Air", Base: true},
+		{Name: "Fire", Base: true},
+		{Name: "Water", Base: true},
+		{Name: "Steam", Tier: 1, Recipes: [][]string{{"Fire", "Water"}, {"Water", "Fire"}, {"Fire", "Water"}}},
+		{Name: "Cloud", Tier: 2, Recipes: [][]string{{"Air", "Steam"}, {"Steam", "Air"}, {"Steam", "Steam"}}},
+	}
+	elementMap, _ := buildGraph(elements)
+	if n := len(elementMap["Steam"].Children); n != 1 {
+		t.Errorf("Steam has %d recipes, want 1", n)
+	}
+	if got := newTreeCounter(elementMap).countName("Cloud"); got.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("Cloud has %s trees, want 2", got)
+	}
+	for _, c := range benchCases {
+		opts := c
+		opts.Element = "Cloud"
+		opts.RecipeAmount = 5
+		var tree ExportableElement
+		var err error
+		tree, err = runSearch(quietContext(false), elements, opts, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", benchLabel(c), err)
+		}
+		if len(tree.Children) != 2 || tree.Meta["treesAvailable"] != "2" {
+			t.Errorf("%s: %d trees of %v available, want 2 of 2", benchLabel(c), len(tree.Children), tree.Meta["treesAvailable"])
+		}
+	}
+}
+
+// Self-combinations, recipes of one or three ingredients and special
+// elements reach the trees of every algorithm
+func TestSpecialRecipes(t *testing.T) {
+	elements := []Element{
+		{Name: "Air", Base: true},
+		{Name: "Fire", Base: true},
+		{Name: "Water", Base: true},
+		{Name: "Time", Base: true, Unlock: &Unlock{Discoveries: 100}},
+		{Name: "Energy", Tier: 1, Recipes: [][]string{{"Fire", "Fire"}}},
+		{Name: "Steam", Tier: 1, Recipes: [][]string{{"Fire", "Water"}, {"Air", "Fire", "Water"}}},
+		{Name: "Cloud", Tier: 2, Recipes: [][]string{{"Steam"}}},
+		{Name: "Clock", Tier: 2, Recipes: [][]string{{"Time", "Energy"}}},
+	}
+	verifier := newTreeVerifier(elements)
+	want := map[string][]string{
+		"Cloud": {"(Steam(Fire+Water))", "(Steam(Air+Fire+Water))"},
+		"Clock": {"(Energy(Fire+Fire)+Time)"},
+	}
+	for _, c := range benchCases {
+		for element, keys := range want {
+			opts := c
+			opts.Element = element
+			opts.RecipeAmount = 5
+			tree, err := runSearch(quietContext(false), elements, opts, nil)
+			if err != nil {
+				t.Fatalf("%s %s: %v", benchLabel(c), element, err)
+			}
+			got := make(map[string]bool)
+			for _, recipe := range tree.Children {
+				got[treeKey(recipe)] = true
+			}
+			for _, key := range keys {
+				if !got[key] {
+					t.Errorf("%s %s: tree %s missing from %v", benchLabel(c), element, key, got)
+				}
+			}
+			if len(got) != len(keys) {
+				t.Errorf("%s %s: trees %v, want %v", benchLabel(c), element, got, keys)
+			}
+			for _, v := range verifier.verify(tree) {
+				t.Errorf("%s %s: %s", benchLabel(c), element, v)
+			}
+		}
+	}
+
+	tree, err := runSearch(quietContext(false), elements, SearchOptions{Element: "Clock", Algorithm: "BFS", RecipeAmount: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock := ""
+	for _, leaf := range tree.Children[0].Children {
+		if leaf.Name == "Time" {
+			unlock = leaf.Attributes["UnlockAfter"]
+		}
+	}
+	if unlock != "100" {
+		t.Errorf("Time unlocked after %q discoveries, want 100", unlock)
+	}
+}
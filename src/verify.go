@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// One problem found in a recipe tree, Path leads from the root to it
+type violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// Recipes keyed by result and sorted ingredient names, so the order the
+// tree lists ingredients in does not matter
+func recipeKey(result string, ingredients []string) string {
+	sorted := append([]string(nil), ingredients...)
+	sort.Strings(sorted)
+	return result + "=" + strings.Join(sorted, "+")
+}
+
+type treeVerifier struct {
+	elements map[string]Element
+	recipes  map[string]bool
+}
+
+func newTreeVerifier(elements []Element) *treeVerifier {
+	v := &treeVerifier{
+		elements: make(map[string]Element, len(elements)),
+		recipes:  make(map[string]bool),
+	}
+	for _, el := range elements {
+		v.elements[el.Name] = el
+		for _, r := range el.Recipes {
+			v.recipes[recipeKey(el.Name, r)] = true
+		}
+	}
+	return v
+}
+
+// Checks an exported tree: every element and recipe exists in the dataset,
+// recipes lower the tier, every leaf is a base element and no element
+// depends on itself
+func (v *treeVerifier) verify(tree ExportableElement) []violation {
+	var violations []violation
+	var walk func(el ExportableElement, path []string)
+	walk = func(el ExportableElement, path []string) {
+		path = append(path, el.Name)
+		where := strings.Join(path, " > ")
+		report := func(format string, args ...any) {
+			violations = append(violations, violation{Path: where, Message: fmt.Sprintf(format, args...)})
+		}
+		data, ok := v.elements[el.Name]
+		if !ok {
+			report("element %q is not in the dataset", el.Name)
+			return
+		}
+		if contains(path[:len(path)-1], el.Name) {
+			report("%s depends on itself", el.Name)
+			return
+		}
+		if len(el.Children) == 0 {
+			if !data.Base {
+				report("leaf %s is not a base element", el.Name)
+			}
+			return
+		}
+		if data.Base {
+			report("base element %s has recipes in the tree", el.Name)
+		}
+		for i, recipe := range el.Children {
+			if len(recipe.Children) == 0 {
+				report("recipe #%d has no ingredients", i+1)
+				continue
+			}
+			names := make([]string, len(recipe.Children))
+			for j, ing := range recipe.Children {
+				names[j] = ing.Name
+			}
+			if !v.recipes[recipeKey(el.Name, names)] {
+				report("recipe #%d %s is not a recipe of %s", i+1, strings.Join(names, " + "), el.Name)
+			}
+			for _, ing := range recipe.Children {
+				if known, ok := v.elements[ing.Name]; ok && known.Tier >= data.Tier {
+					report("recipe #%d uses %s (tier %d) for tier %d", i+1, ing.Name, known.Tier, data.Tier)
+				}
+				walk(ing, path)
+			}
+		}
+	}
+	walk(tree, nil)
+	return violations
+}
+
+// Same checks on the internal graph an algorithm built from root. Every
+// node is checked once, on the first path reaching it, so shared subtrees
+// do not multiply the work.
+func verifyGraph(root *ElementNode) []violation {
+	var violations []violation
+	onPath := make(map[*ElementNode]bool)
+	checked := make(map[*ElementNode]bool)
+	var walk func(node *ElementNode, path []string)
+	walk = func(node *ElementNode, path []string) {
+		path = append(path, node.Name)
+		where := strings.Join(path, " > ")
+		if onPath[node] {
+			violations = append(violations, violation{Path: where, Message: node.Name + " depends on itself"})
+			return
+		}
+		if checked[node] {
+			return
+		}
+		checked[node] = true
+		if node.IsBase {
+			return
+		}
+		onPath[node] = true
+		defer delete(onPath, node)
+		if len(node.Children) == 0 {
+			violations = append(violations, violation{Path: where, Message: "leaf " + node.Name + " is not a base element"})
+			return
+		}
+		for i, recipe := range node.Children {
+			if recipe.Result != node.Name {
+				violations = append(violations, violation{Path: where, Message: fmt.Sprintf("recipe #%d makes %s, not %s", i+1, recipe.Result, node.Name)})
+			}
+			if !recipe.usableFor(node.Tier) {
+				violations = append(violations, violation{Path: where, Message: fmt.Sprintf("recipe #%d %s does not lower the tier", i+1, recipe)})
+			}
+			for _, ing := range recipe.Ingredients {
+				if ing != nil {
+					walk(ing, path)
+				}
+			}
+		}
+	}
+	walk(root, nil)
+	return violations
+}
+
+// Checks a search returned min(limit, available) distinct trees, the same
+// for every algorithm
+func verifyTreeCount(tree ExportableElement, available *big.Int, limit int) []violation {
+	var violations []violation
+	seen := make(map[string]int)
+	for i, recipe := range tree.Children {
+		key, _ := json.Marshal(recipe)
+		if first, ok := seen[string(key)]; ok {
+			violations = append(violations, violation{Path: tree.Name, Message: fmt.Sprintf("tree #%d repeats tree #%d", i+1, first+1)})
+			continue
+		}
+		seen[string(key)] = i
+	}
+	want := int64(limit)
+	if available.IsInt64() && available.Int64() < want {
+		want = available.Int64()
+	}
+	got := int64(len(tree.Children))
+	if len(tree.Children) == 0 && available.Sign() > 0 {
+		// A base element is its own single tree
+		got = 1
+	}
+	if got != want {
+		violations = append(violations, violation{Path: tree.Name, Message: fmt.Sprintf("returned %d trees, expected %d of %s", got, want, available)})
+	}
+	return violations
+}
+
+// Runs the tree, tree count and graph checks on one search result. An
+// element without any tree, one whose tier is mislabelled for example,
+// must come back without recipes, the other checks do not apply to it.
+func verifySearch(verifier *treeVerifier, tree ExportableElement, graph map[string]*ElementNode, available *big.Int, limit int) []violation {
+	if available.Sign() == 0 {
+		if len(tree.Children) > 0 {
+			return []violation{{Path: tree.Name, Message: fmt.Sprintf("returned %d trees, no tree is available", len(tree.Children))}}
+		}
+		return nil
+	}
+	violations := verifier.verify(tree)
+	violations = append(violations, verifyTreeCount(tree, available, limit)...)
+	for _, v := range verifyGraph(graph[tree.Name]) {
+		v.Message = "graph: " + v.Message
+		violations = append(violations, v)
+	}
+	return violations
+}
+
+// Lowest cost of any tree of each element, +Inf when it has none
+func minCosts(elementMap map[string]*ElementNode) map[*ElementNode]float64 {
+	costs := make(map[*ElementNode]float64, len(elementMap))
+	var visit func(node *ElementNode) float64
+	visit = func(node *ElementNode) float64 {
+		if c, ok := costs[node]; ok {
+			return c
+		}
+		c := math.Inf(1)
+		if node.IsBase {
+			c = node.Cost
+		}
+		for _, recipe := range node.Children {
+			if !recipe.usableFor(node.Tier) {
+				continue
+			}
+			sum := recipe.Cost
+			for _, ing := range recipe.Ingredients {
+				sum += visit(ing)
+			}
+			c = min(c, sum)
+		}
+		costs[node] = c
+		return c
+	}
+	for _, node := range elementMap {
+		visit(node)
+	}
+	return costs
+}
+
+// Debug annotation added to responses with ?verify=true
+func verifyMeta(violations []violation) map[string]any {
+	if violations == nil {
+		violations = []violation{}
+	}
+	return map[string]any{
+		"valid":      len(violations) == 0,
+		"violations": violations,
+	}
+}
+
+// verify runs every algorithm over every element and checks each tree, the
+// number of trees and the graph, failing when any violation is found
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	load := datasetFlags(fs)
+	only := fs.String("elements", "", "comma separated elements to check (default: all)")
+	amounts := fs.String("n", "1,3", "comma separated recipe amounts to check")
+	limit := fs.Int("show", 20, "number of violations printed")
+	diverse := fs.Bool("diverse", false, "check diverse results")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	ds, err := load()
+	if err != nil {
+		return err
+	}
+	verifier := newTreeVerifier(ds.Elements)
+	elementMap, _ := buildGraph(ds.Elements)
+	counter := newTreeCounter(elementMap)
+	optimal := minCosts(elementMap)
+	wanted := splitList(*only)
+
+	var recipeAmounts []int
+	for _, s := range splitList(*amounts) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid recipe amount %q", s)
+		}
+		recipeAmounts = append(recipeAmounts, n)
+	}
+
+	checked, failed, shown, unavailable := 0, 0, 0, 0
+	for _, el := range ds.Elements {
+		if len(wanted) > 0 && !contains(wanted, el.Name) {
+			continue
+		}
+		available := counter.countName(el.Name)
+		if available.Sign() == 0 {
+			unavailable++
+		}
+		for _, c := range benchCases {
+			for _, n := range recipeAmounts {
+				opts := c
+				opts.Element = el.Name
+				opts.Diverse = *diverse
+				opts.RecipeAmount = n
+				var tree ExportableElement
+				var graph map[string]*ElementNode
+				tree, graph, err = searchGraph(quietContext(false), ds.Elements, opts, nil)
+				if err != nil {
+					return fmt.Errorf("%s %s: %w", benchLabel(c), el.Name, err)
+				}
+				checked++
+				violations := verifySearch(verifier, tree, graph, available, opts.RecipeAmount)
+				// The benchmarked heuristics are lower bounds, so the first
+				// tree is within the weight of the lowest cost
+				if costs, ok := tree.Meta["costs"].([]treeCost); ok && opts.Algorithm == "AStar" && len(costs) > 0 {
+					if best := optimal[elementMap[el.Name]]; costs[0].Total > max(opts.Weight, 1)*best+1e-9 {
+						violations = append(violations, violation{Path: el.Name, Message: fmt.Sprintf("first tree costs %g, the lowest is %g", costs[0].Total, best)})
+					}
+				}
+				if len(violations) == 0 {
+					continue
+				}
+				failed++
+				for _, v := range violations {
+					if shown < *limit {
+						fmt.Printf("%s n=%d: %s\n", benchLabel(c), opts.RecipeAmount, v)
+					}
+					shown++
+				}
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Checked %d trees, %d invalid, %d violations\n", checked, failed, shown)
+	if unavailable > 0 {
+		fmt.Fprintf(os.Stderr, "%d elements have no tree available\n", unavailable)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d trees are invalid", failed, checked)
+	}
+	return nil
+}
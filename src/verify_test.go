@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Small datasets with cycles, dangling ingredients and n-ary recipes
+var verifyDatasets = []generatorOptions{
+	{Elements: 40, Base: 4, Tiers: 6, Recipes: 3, MinIngredients: 2, MaxIngredients: 2, Cycles: 4, Dangling: 4, Seed: 1},
+	{Elements: 40, Base: 3, Tiers: 5, Recipes: 2, MinIngredients: 1, MaxIngredients: 4, Cycles: 6, Dangling: 2, Seed: 2},
+	{Elements: 25, Base: 1, Tiers: 8, Recipes: 4, MinIngredients: 1, MaxIngredients: 3, Cycles: 2, Dangling: 6, Seed: 3},
+}
+
+// Every tree of every algorithm is valid, the graph the algorithm left is
+// valid and the number of trees is min(limit, available)
+func TestVerifyAllElements(t *testing.T) {
+	for _, dataset := range verifyDatasets {
+		elements := testElements(t, dataset)
+		verifier := newTreeVerifier(elements)
+		elementMap, _ := buildGraph(elements)
+		counter := newTreeCounter(elementMap)
+		for _, c := range benchCases {
+			t.Run(fmt.Sprintf("seed=%d/%s", dataset.Seed, benchLabel(c)), func(t *testing.T) {
+				for _, el := range elements {
+					for _, n := range []int{1, 3} {
+						opts := c
+						opts.Element = el.Name
+						opts.RecipeAmount = n
+						var tree ExportableElement
+						var graph map[string]*ElementNode
+						var err error
+						tree, graph, err = searchGraph(quietContext(false), elements, opts, nil)
+						if err != nil {
+							t.Fatalf("%s n=%d: %v", el.Name, n, err)
+						}
+						violations := verifySearch(verifier, tree, graph, counter.countName(el.Name), n)
+						for _, v := range violations {
+							t.Errorf("%s n=%d: %s", el.Name, n, v)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// The verifier itself reports broken trees
+func TestVerifierRejectsInvalidTrees(t *testing.T) {
+	elements := []Element{
+		{Name: "Air", Base: true},
+		{Name: "Fire", Base: true},
+		{Name: "Energy", Tier: 1, Recipes: [][]string{{"Fire", "Fire"}}},
+		{Name: "Heat", Tier: 2, Recipes: [][]string{{"Air", "Energy"}}},
+	}
+	leaf := func(name string) ExportableElement { return ExportableElement{Name: name} }
+	made := func(name string, ings ...ExportableElement) ExportableElement {
+		return ExportableElement{Name: name, Children: []ExportableRecipe{{Children: ings}}}
+	}
+	cases := map[string]ExportableElement{
+		"unknown recipe":    made("Heat", leaf("Air"), leaf("Fire")),
+		"unknown element":   made("Heat", leaf("Air"), leaf("Water")),
+		"leaf not base":     made("Heat", leaf("Air"), leaf("Energy")),
+		"tier not lowered":  made("Energy", leaf("Fire"), made("Heat", leaf("Air"), made("Energy", leaf("Fire"), leaf("Fire")))),
+		"base with recipes": made("Heat", made("Air", leaf("Fire")), made("Energy", leaf("Fire"), leaf("Fire"))),
+	}
+	verifier := newTreeVerifier(elements)
+	for name, tree := range cases {
+		if len(verifier.verify(tree)) == 0 {
+			t.Errorf("%s: no violation reported", name)
+		}
+	}
+	valid := made("Heat", leaf("Air"), made("Energy", leaf("Fire"), leaf("Fire")))
+	if violations := verifier.verify(valid); len(violations) > 0 {
+		t.Errorf("valid tree: %v", violations)
+	}
+}
+
+// Dataset whose element with the highest tier is labelled one tier lower,
+// so its recipes no longer lower the tier and it has no tree
+func mislabelledElements(tb testing.TB) ([]Element, string) {
+	tb.Helper()
+	elements := testElements(tb, generatorOptions{Elements: 30, Base: 4, Tiers: 5, Recipes: 1, MinIngredients: 2, MaxIngredients: 2, Seed: 4})
+	top := 0
+	for i, el := range elements {
+		if el.Tier > elements[top].Tier {
+			top = i
+		}
+	}
+	elements[top].Tier--
+	return elements, elements[top].Name
+}
+
+// An element without any tree comes back empty and is not reported as a
+// broken tree
+func TestVerifyElementWithoutTree(t *testing.T) {
+	elements, name := mislabelledElements(t)
+	elementMap, _ := buildGraph(elements)
+	available := newTreeCounter(elementMap).countName(name)
+	if available.Sign() != 0 {
+		t.Fatalf("%s has %s trees, want none", name, available)
+	}
+	verifier := newTreeVerifier(elements)
+	for _, c := range benchCases {
+		opts := c
+		opts.Element = name
+		opts.RecipeAmount = 3
+		var tree ExportableElement
+		var graph map[string]*ElementNode
+		var err error
+		tree, graph, err = searchGraph(quietContext(false), elements, opts, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", benchLabel(c), err)
+		}
+		for _, v := range verifySearch(verifier, tree, graph, available, 3) {
+			t.Errorf("%s: %s", benchLabel(c), v)
+		}
+	}
+	tree := ExportableElement{Name: name, Children: []ExportableRecipe{{}}}
+	if len(verifySearch(verifier, tree, nil, available, 3)) == 0 {
+		t.Error("no violation for a tree of an element without trees")
+	}
+}
+
+// The verify command accepts a dataset with a mislabelled tier and
+// refuses recipe amounts that are not numbers
+func TestVerifyCommand(t *testing.T) {
+	elements, name := mislabelledElements(t)
+	jsonBytes, err := convertToJson(elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "elements.json")
+	if err := os.WriteFile(file, jsonBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCommand([]string{"-data", file, "-n", "1,2"}); err != nil {
+		t.Errorf("mislabelled %s: %v", name, err)
+	}
+	if err := verifyCommand([]string{"-data", file, "-n", "1,x"}); err == nil {
+		t.Error("no error for the recipe amount x")
+	}
+}
+
+// Elements reachable along many paths are checked once, a chain of
+// elements with two recipes over the previous one has 2^depth paths
+func TestVerifyGraphSharedNodes(t *testing.T) {
+	base := &ElementNode{Name: "Base", IsBase: true}
+	prev := base
+	for i := 1; i <= 64; i++ {
+		node := &ElementNode{Name: fmt.Sprintf("E%d", i), Tier: i}
+		for range 2 {
+			node.Children = append(node.Children, &RecipeNode{Result: node.Name, Ingredients: []*ElementNode{prev, base}})
+		}
+		prev = node
+	}
+	if violations := verifyGraph(prev); len(violations) > 0 {
+		t.Errorf("valid graph: %v", violations)
+	}
+
+	loop := &ElementNode{Name: "Loop", Tier: 2}
+	loop.Children = []*RecipeNode{{Result: "Loop", Ingredients: []*ElementNode{base, loop}}}
+	top := &ElementNode{Name: "Top", Tier: 3}
+	top.Children = []*RecipeNode{{Result: "Top", Ingredients: []*ElementNode{loop, loop}}}
+	found := false
+	for _, v := range verifyGraph(top) {
+		found = found || strings.HasSuffix(v.Message, "depends on itself")
+	}
+	if !found {
+		t.Error("cycle through Loop not reported")
+	}
+}
+
+// Every cycle of the generator is one, whatever the seed: checked over the
+// whole graph, with every recipe of the dataset, an element depends on itself
+func TestVerifyGeneratedCycles(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		for _, cycles := range []int{0, 1} {
+			elements := testElements(t, generatorOptions{Elements: 20, Base: 3, Tiers: 4, Recipes: 2, MinIngredients: 2, MaxIngredients: 2, Cycles: cycles, Seed: seed})
+			elementMap, _ := buildGraph(elements)
+			found := false
+			for _, el := range elements {
+				for _, v := range verifyGraph(elementMap[el.Name]) {
+					found = found || strings.HasSuffix(v.Message, "depends on itself")
+				}
+			}
+			if found != (cycles > 0) {
+				t.Errorf("seed %d with %d cycles: cycle reported %t", seed, cycles, found)
+			}
+		}
+	}
+}
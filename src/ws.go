@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Commands the client can send over the websocket
+type wsCommand struct {
+	Command string `json:"command"`
+	Value   int    `json:"value"`
+}
+
+// Controls a live search shared by the event loop and the command reader
+type liveControl struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	paused    bool
+	steps     int
+	delay     time.Duration
+	cancelled bool
+	snapshot  bool
+	// Done once cancelled, stops the search itself
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+func newLiveControl(delay time.Duration) *liveControl {
+	ctrl := &liveControl{delay: delay}
+	ctrl.cond = sync.NewCond(&ctrl.mu)
+	ctrl.ctx, ctrl.stop = context.WithCancel(context.Background())
+	return ctrl
+}
+
+func (ctrl *liveControl) apply(cmd wsCommand) error {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	defer ctrl.cond.Broadcast()
+
+	switch cmd.Command {
+	case "pause":
+		ctrl.paused = true
+	case "resume":
+		ctrl.paused = false
+	case "delay":
+		if cmd.Value < 0 {
+			return fmt.Errorf("delay must not be negative")
+		}
+		ctrl.delay = time.Duration(cmd.Value) * time.Millisecond
+	case "step":
+		ctrl.steps++
+	case "cancel":
+		ctrl.cancelled = true
+		ctrl.stop()
+	case "snapshot":
+		ctrl.snapshot = true
+	default:
+		return fmt.Errorf("unknown command %q", cmd.Command)
+	}
+	return nil
+}
+
+func (ctrl *liveControl) cancel() {
+	ctrl.mu.Lock()
+	ctrl.cancelled = true
+	ctrl.mu.Unlock()
+	ctrl.stop()
+	ctrl.cond.Broadcast()
+}
+
+func (ctrl *liveControl) isCancelled() bool {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	return ctrl.cancelled
+}
+
+func (ctrl *liveControl) currentDelay() time.Duration {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	return ctrl.delay
+}
+
+func (ctrl *liveControl) status() map[string]any {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	return map[string]any{
+		"paused":    ctrl.paused,
+		"delay":     ctrl.delay.Milliseconds(),
+		"cancelled": ctrl.cancelled,
+	}
+}
+
+// Blocks while the search is paused. Snapshot requests are served while
+// waiting since the search itself is blocked on the event channel.
+// Returns false once the search has been cancelled.
+func (ctrl *liveControl) gate(sendSnapshot func()) bool {
+	ctrl.mu.Lock()
+	defer ctrl.mu.Unlock()
+	for {
+		if ctrl.cancelled {
+			return false
+		}
+		if ctrl.snapshot {
+			ctrl.snapshot = false
+			ctrl.mu.Unlock()
+			sendSnapshot()
+			ctrl.mu.Lock()
+			continue
+		}
+		if !ctrl.paused {
+			return true
+		}
+		if ctrl.steps > 0 {
+			ctrl.steps--
+			return true
+		}
+		ctrl.cond.Wait()
+	}
+}
+
+// Serializes writes since the reader goroutine also replies to commands
+type wsSender struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (s *wsSender) send(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return websocket.JSON.Send(s.conn, v)
+}
+
+func liveWebSocket(registry *datasetRegistry) http.Handler {
+	return websocket.Server{
+		// Allow any origin, same as withCORS
+		Handshake: func(config *websocket.Config, r *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			r := conn.Request()
+			sender := &wsSender{conn: conn}
+
+			algorithm := r.URL.Query().Get("algorithm")
+			if algorithm == "" {
+				algorithm = "DFS"
+			}
+			params, err := parseSearchParams(r, "/ws/")
+			if err != nil {
+				sender.send(map[string]any{"error": err.Error()})
+				return
+			}
+			elmtName, val, delay := params.Element, params.RecipeAmount, params.Delay
+
+			name := r.URL.Query().Get("dataset")
+			store, ok := registry.get(name)
+			if !ok {
+				sender.send(map[string]any{"error": fmt.Sprintf("dataset %q not found", name)})
+				return
+			}
+			ds := store.load()
+			rawElements, err := params.elements(ds.Elements)
+			if err != nil {
+				sender.send(map[string]any{"error": err.Error()})
+				return
+			}
+			elementMap, allRecipes := buildGraph(rawElements)
+			root, exists := elementMap[elmtName]
+			if !exists {
+				sender.send(map[string]any{"error": errElementNotFound.Error()})
+				return
+			}
+			fmt.Printf("Starting websocket %s for element: %s\n", algorithm, elmtName)
+
+			ctrl := newLiveControl(time.Duration(delay) * time.Millisecond)
+			defer ctrl.stop()
+			go func() {
+				for {
+					var cmd wsCommand
+					if err := websocket.JSON.Receive(conn, &cmd); err != nil {
+						// Client is gone, let the search drain
+						ctrl.cancel()
+						return
+					}
+					if err := ctrl.apply(cmd); err != nil {
+						sender.send(map[string]any{"error": err.Error()})
+						continue
+					}
+					sender.send(map[string]any{"status": ctrl.status()})
+				}
+			}()
+
+			trees := newTreeCollector(elementMap)
+			// Searches writing the tree from several goroutines share their lock
+			treeMu := &sync.Mutex{}
+			sendTree := func(extra map[string]any) {
+				treeMu.Lock()
+				payload := map[string]any{"depth": exportTree(root)}
+				treeMu.Unlock()
+				for k, v := range extra {
+					payload[k] = v
+				}
+				if err := sender.send(payload); err != nil {
+					ctrl.cancel()
+				}
+			}
+			sendSnapshot := func() { sendTree(map[string]any{"snapshot": true}) }
+
+			switch algorithm {
+			case "DFS":
+				search := newLiveDFSSearch(ctrl.ctx, val)
+				treeMu = search.mu
+				search.runLive(root, elementMap)
+
+				// Once cancelled the search visits no more elements, the
+				// steps left only unwind it
+				for step := range search.steps {
+					if ctrl.gate(sendSnapshot) {
+						sendTree(nil)
+						time.Sleep(ctrl.currentDelay())
+					}
+					close(step.ack)
+				}
+			case "BFS":
+				ch := make(chan int)
+				// Cancelling stops the search, the events left are drained
+				go bfs(ctrl.ctx, root, elementMap, allRecipes, val, ch)
+
+				for range ch {
+					if !ctrl.gate(sendSnapshot) {
+						continue
+					}
+					sendTree(nil)
+					time.Sleep(ctrl.currentDelay())
+				}
+			case "IDDFS":
+				iddfs(ctrl.ctx, root, func(limit int) {
+					if !ctrl.gate(sendSnapshot) {
+						return
+					}
+					sendTree(map[string]any{"iteration": limit})
+					time.Sleep(ctrl.currentDelay())
+				})
+			default:
+				sender.send(map[string]any{"error": fmt.Sprintf("unknown algorithm %q", algorithm)})
+				return
+			}
+
+			if ctrl.isCancelled() {
+				fmt.Println("Websocket search cancelled")
+				sender.send(map[string]any{"status": ctrl.status()})
+				return
+			}
+			payload := map[string]any{"depth": trees.collect(root, val, params.Diverse), "done": true, "datasetVersion": ds.Version}
+			if err := sender.send(payload); err != nil {
+				ctrl.cancel()
+			}
+			fmt.Println("Final websocket payload sent.")
+		},
+	}
+}
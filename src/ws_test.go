@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// Messages of a websocket search until its final trees or an error
+func receiveLive(tb testing.TB, srv *httptest.Server, target string) []map[string]any {
+	tb.Helper()
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+target, "", srv.URL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer conn.Close()
+	var msgs []map[string]any
+	for {
+		var msg map[string]any
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			tb.Fatalf("%s: %v after %d messages", target, err, len(msgs))
+		}
+		msgs = append(msgs, msg)
+		if msg["done"] == true || msg["error"] != nil {
+			return msgs
+		}
+	}
+}
+
+// DFS over the websocket ends with the final trees when the recipe amount
+// lets it run on several goroutines
+func TestWebSocketDFS(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, testRegistry(t), newResultCache(16, ""), serverConfig{})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, amount := range []int{1, 3, 4, 6} {
+		target := fmt.Sprintf("/ws/T5E1?algorithm=DFS&recipeAmount=%d", amount)
+		msgs := receiveLive(t, srv, target)
+		last := msgs[len(msgs)-1]
+		if last["error"] != nil {
+			t.Fatalf("%s: %v", target, last["error"])
+		}
+		if len(msgs) < 2 {
+			t.Errorf("%s: no steps before the final trees", target)
+		}
+		if tree, _ := last["depth"].(map[string]any); tree["name"] != "T5E1" {
+			t.Errorf("%s: final trees %v", target, tree)
+		}
+	}
+}
+
+// Owned elements are leaves over the websocket too, unknown ones an error
+func TestWebSocketCostOptions(t *testing.T) {
+	mux := http.NewServeMux()
+	registerRoutes(mux, testRegistry(t), newResultCache(16, ""), serverConfig{})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, algorithm := range []string{"DFS", "BFS", "IDDFS"} {
+		target := "/ws/T4E1?algorithm=" + algorithm + "&recipeAmount=2&owned=T4E1"
+		msgs := receiveLive(t, srv, target)
+		last := msgs[len(msgs)-1]
+		tree, _ := last["depth"].(map[string]any)
+		if children, _ := tree["children"].([]any); last["error"] != nil || tree["name"] != "T4E1" || len(children) != 0 {
+			t.Errorf("%s: owned T4E1 is not a leaf: %v", target, last)
+		}
+
+		target = "/ws/T4E1?algorithm=" + algorithm + "&recipeAmount=2&owned=Nope"
+		if msgs := receiveLive(t, srv, target); msgs[len(msgs)-1]["error"] == nil {
+			t.Errorf("%s: no error", target)
+		}
+	}
+}